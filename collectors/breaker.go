@@ -0,0 +1,169 @@
+package collectors
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/common/log"
+	"hub4_exporter/config"
+	"hub4_exporter/drivers"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Defaults for retries and circuit breakers
+const (
+	defaultRetryBackoff = time.Second
+	defaultOpenDuration = time.Minute
+)
+
+// Circuit breaker states, the values of hub4_circuit_state
+const (
+	circuitClosed   = 0
+	circuitOpen     = 1
+	circuitHalfOpen = 2
+)
+
+var errCircuitOpen = errors.New("circuit breaker open after repeated failures")
+
+// circuitBreaker stops fetching from an instance after repeated failures, so
+// scrapes fail fast while a modem is down. Once open for long enough a
+// single trial fetch is let through, closing the breaker if it succeeds,
+// and other fetches are rejected until it finishes.
+type circuitBreaker struct {
+	mutex        sync.Mutex
+	instance     string
+	threshold    int
+	openDuration time.Duration
+	state        int
+	failures     int
+	openedAt     time.Time
+	trial        bool
+}
+
+func newCircuitBreaker(instance string, conf *config.CircuitBreakerConfig) *circuitBreaker {
+	openDuration := conf.OpenDuration
+	if openDuration == 0 {
+		openDuration = defaultOpenDuration
+	}
+	return &circuitBreaker{
+		instance:     instance,
+		threshold:    conf.FailureThreshold,
+		openDuration: openDuration,
+	}
+}
+
+// allow reports whether the instance can be fetched from, a nil breaker
+// always allows
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.openDuration {
+			return false
+		}
+		b.state = circuitHalfOpen
+	case circuitHalfOpen:
+		if b.trial {
+			return false
+		}
+	}
+	b.trial = b.state == circuitHalfOpen
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state != circuitClosed {
+		log.Infof("Circuit breaker of instance %s closed", b.instance)
+	}
+	b.state = circuitClosed
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *circuitBreaker) failure() {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures++
+	b.trial = false
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		if b.state != circuitOpen {
+			log.Warnf("Circuit breaker of instance %s opened after %d failures in a row", b.instance, b.failures)
+		}
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *circuitBreaker) currentState() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.state
+}
+
+// retryConfig returns the instance's retry settings, falling back to the
+// defaults
+func (p *Exporter) retryConfig(instance *config.InstancesConfig) *config.RetryConfig {
+	if instance.Retry != nil {
+		return instance.Retry
+	}
+	if p.config.Retry != nil {
+		return p.config.Retry
+	}
+	return &config.RetryConfig{}
+}
+
+// breakerConfig returns the instance's circuit breaker settings, or nil if
+// it has none
+func (p *Exporter) breakerConfig(instance *config.InstancesConfig) *config.CircuitBreakerConfig {
+	conf := p.config.CircuitBreaker
+	if instance.CircuitBreaker != nil {
+		conf = instance.CircuitBreaker
+	}
+	if conf == nil || conf.FailureThreshold <= 0 {
+		return nil
+	}
+	return conf
+}
+
+// fetch fetches from an instance, retrying with a doubling backoff while
+// there's time left before ctx's deadline
+func (p *Exporter) fetch(ctx context.Context, driver drivers.Driver, httpClient *http.Client, instance *config.InstancesConfig) ([]byte, error) {
+	retry := p.retryConfig(instance)
+	backoff := retry.Backoff
+	if backoff == 0 {
+		backoff = defaultRetryBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		body, err := driver.Fetch(ctx, httpClient, instance)
+		if err == nil || attempt >= retry.Attempts || ctx.Err() != nil {
+			return body, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return nil, err
+		}
+		log.Debugf("Fetch from instance %s failed, retrying in %s: %s", instance.Name, backoff, err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,41 @@
+package collectors
+
+import (
+	"hub4_exporter/config"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerSingleTrial(t *testing.T) {
+	b := newCircuitBreaker("hub", &config.CircuitBreakerConfig{FailureThreshold: 1, OpenDuration: time.Millisecond})
+	b.failure()
+	if b.allow() {
+		t.Fatal("open breaker allowed a fetch")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("breaker didn't allow a trial fetch after the open duration")
+	}
+	for i := 0; i < 3; i++ {
+		if b.allow() {
+			t.Fatal("half-open breaker allowed a second fetch during the trial")
+		}
+	}
+
+	// A failed trial opens the breaker again
+	b.failure()
+	if state := b.currentState(); state != circuitOpen {
+		t.Fatalf("state after failed trial = %d, want %d", state, circuitOpen)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("breaker didn't allow a second trial fetch")
+	}
+	b.success()
+	for i := 0; i < 3; i++ {
+		if !b.allow() {
+			t.Fatal("closed breaker rejected a fetch")
+		}
+	}
+}
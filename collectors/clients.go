@@ -0,0 +1,103 @@
+package collectors
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"hub4_exporter/config"
+	"hub4_exporter/drivers"
+	"hub4_exporter/hub4"
+	"sort"
+	"strings"
+)
+
+const hub4ClientsPath = "/php/ajaxGet_device_connected_clients_data.php"
+
+// Most clients reported in hub4_client_info by default
+const defaultMaxClients = 100
+
+// Characters dropped from interface and band labels
+var clientLabelReplacer = strings.NewReplacer(" ", "", "-", "")
+
+// clientLabel normalises an interface or band, such as "Wi-Fi" to wifi or
+// "2.4 GHz" to 2.4ghz
+func clientLabel(s string) string {
+	return strings.ToLower(clientLabelReplacer.Replace(strings.TrimSpace(s)))
+}
+
+// collectClients reports the number of devices connected to a Hub 4 by
+// interface and band, and optionally each device
+func (p *Exporter) collectClients(ctx context.Context, ch chan<- prometheus.Metric, instance *config.InstancesConfig, session *drivers.Hub4Session) error {
+	body, err := session.Get(ctx, hub4ClientsPath)
+	if err != nil {
+		return err
+	}
+	clients, err := hub4.DecodeClients(body)
+	if err != nil {
+		return err
+	}
+
+	// A client seen on two bands of the same interface is only counted once,
+	// under the first band it's listed with, as in hub4_client_info
+	model := p.model(instance)
+	type key struct{ iface, band string }
+	counts := map[key]int{}
+	type device struct{ iface, mac string }
+	counted := map[device]bool{}
+	for _, client := range clients {
+		iface := clientLabel(client.Interface)
+		if mac := strings.ToLower(client.MAC); mac != "" {
+			if counted[device{iface, mac}] {
+				continue
+			}
+			counted[device{iface, mac}] = true
+		}
+		counts[key{iface, clientLabel(client.Band)}]++
+	}
+	for k, count := range counts {
+		ch <- prometheus.MustNewConstMetric(p.connectedClients, prometheus.GaugeValue, float64(count), instance.Name, instance.Address, model, k.iface, k.band)
+	}
+
+	conf := instance.Clients
+	if conf == nil || !conf.Info {
+		return nil
+	}
+	maxClients := conf.MaxClients
+	if maxClients == 0 {
+		maxClients = defaultMaxClients
+	}
+
+	// A client seen on two bands of the same interface has the same labels
+	// twice, so it's only reported once
+	type info struct{ mac, hostname, ip, iface string }
+	seen := map[info]bool{}
+	var infos []info
+	for _, client := range clients {
+		hostname, ip := client.Hostname, client.IP
+		if conf.HashLabels {
+			hostname, ip = p.hashLabel(hostname), p.hashLabel(ip)
+		}
+		i := info{p.hashLabel(strings.ToLower(client.MAC)), hostname, ip, clientLabel(client.Interface)}
+		if !seen[i] {
+			seen[i] = true
+			infos = append(infos, i)
+		}
+	}
+
+	// Sort so the same clients are kept when there are too many
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].mac != infos[j].mac {
+			return infos[i].mac < infos[j].mac
+		}
+		return infos[i].iface < infos[j].iface
+	})
+	if len(infos) > maxClients {
+		log.Debugf("Instance %s has %d clients, only reporting %d", instance.Name, len(infos), maxClients)
+		infos = infos[:maxClients]
+	}
+	for _, i := range infos {
+		ch <- prometheus.MustNewConstMetric(p.clientInfo, prometheus.GaugeValue, float64(1), instance.Name, instance.Address, model,
+			i.mac, i.hostname, i.ip, i.iface)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package collectors
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"hub4_exporter/config"
+	"hub4_exporter/drivers"
+	"sync"
+	"time"
+)
+
+// fetch is a collection of an instance that's under way
+type fetch struct {
+	ctx     *fetchContext
+	done    chan struct{}
+	metrics []prometheus.Metric
+}
+
+// fetchContext is the context a fetch runs on, it isn't cancelled with any
+// one scrape but its deadline is brought forward to the earliest deadline of
+// the scrapes waiting for it
+type fetchContext struct {
+	mutex    sync.Mutex
+	done     chan struct{}
+	deadline time.Time
+	timer    *time.Timer
+	err      error
+}
+
+func newFetchContext(deadline time.Time) *fetchContext {
+	c := &fetchContext{done: make(chan struct{}), deadline: deadline}
+	// Held so that a deadline already past can't end it before timer is set
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.timer = time.AfterFunc(time.Until(deadline), func() {
+		c.end(context.DeadlineExceeded)
+	})
+	return c
+}
+
+// end ends the context with err, unless it has already ended
+func (c *fetchContext) end(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.timer.Stop()
+	c.err = err
+	close(c.done)
+}
+
+// shorten brings the deadline forward to deadline if it's earlier
+func (c *fetchContext) shorten(deadline time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err != nil || !deadline.Before(c.deadline) {
+		return
+	}
+	c.deadline = deadline
+	if c.timer.Stop() {
+		c.timer.Reset(time.Until(deadline))
+	}
+}
+
+func (c *fetchContext) Deadline() (time.Time, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.deadline, true
+}
+
+func (c *fetchContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *fetchContext) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+func (c *fetchContext) Value(key interface{}) interface{} {
+	return nil
+}
+
+// coalescer merges concurrent collections of the same instance, scrapes that
+// start while one is under way wait for it and get the same metrics
+type coalescer struct {
+	mutex    sync.Mutex
+	inflight map[string]*fetch
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{
+		inflight: map[string]*fetch{},
+	}
+}
+
+// do runs collect for the instance unless it's already running, returning
+// its metrics and whether this call waited for another's. The collection
+// runs on its own context, so that a scrape cancelled early doesn't cut it
+// short for the others, limited to the earliest deadline of the scrapes
+// waiting for it and at most timeout. An error is returned if ctx ends
+// before the collection.
+func (c *coalescer) do(ctx context.Context, instance string, timeout time.Duration, collect func(ctx context.Context) []prometheus.Metric) ([]prometheus.Metric, bool, error) {
+	deadline := time.Now().Add(timeout)
+	if scrapeDeadline, ok := ctx.Deadline(); ok && scrapeDeadline.Before(deadline) {
+		deadline = scrapeDeadline
+	}
+
+	c.mutex.Lock()
+	f, waited := c.inflight[instance]
+	if waited {
+		f.ctx.shorten(deadline)
+	} else {
+		f = &fetch{ctx: newFetchContext(deadline), done: make(chan struct{})}
+		c.inflight[instance] = f
+		go func() {
+			f.metrics = collect(f.ctx)
+			f.ctx.end(context.Canceled)
+
+			c.mutex.Lock()
+			delete(c.inflight, instance)
+			c.mutex.Unlock()
+			close(f.done)
+		}()
+	}
+	c.mutex.Unlock()
+
+	select {
+	case <-f.done:
+		return f.metrics, waited, nil
+	case <-ctx.Done():
+		return nil, waited, ctx.Err()
+	}
+}
+
+// gatherInstance collects the metrics of one instance into a slice,
+// returning whether it was successful
+func (p *Exporter) gatherInstance(ctx context.Context, instance *config.InstancesConfig) ([]prometheus.Metric, bool) {
+	ch := make(chan prometheus.Metric)
+	done := make(chan bool, 1)
+	go func() {
+		defer close(ch)
+		httpClient, err := p.httpClient(instance)
+		if err != nil {
+			p.scrapeFailed(ch, instance, drivers.ReasonConnectionError, err, false)
+			done <- false
+			return
+		}
+		done <- p.collectInstance(ctx, ch, instance, httpClient, false)
+	}()
+
+	var metrics []prometheus.Metric
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	return metrics, <-done
+}
@@ -0,0 +1,53 @@
+package collectors
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+	"time"
+)
+
+func TestCoalescerFetchOutlivesScrape(t *testing.T) {
+	c := newCoalescer()
+	release := make(chan struct{})
+	fetchErr := make(chan error, 1)
+	metric := prometheus.MustNewConstMetric(prometheus.NewDesc("test", "test", nil, nil), prometheus.GaugeValue, 1)
+	collect := func(ctx context.Context) []prometheus.Metric {
+		<-release
+		fetchErr <- ctx.Err()
+		return []prometheus.Metric{metric}
+	}
+
+	// The first scrape gives up before the fetch finishes
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, _, err := c.do(ctx, "0/hub", time.Minute, collect)
+		first <- err
+	}()
+	for {
+		c.mutex.Lock()
+		_, started := c.inflight["0/hub"]
+		c.mutex.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("first scrape: got error %v, want %v", err, context.Canceled)
+	}
+	c.mutex.Lock()
+	f := c.inflight["0/hub"]
+	c.mutex.Unlock()
+	close(release)
+	if err := <-fetchErr; err != nil {
+		t.Errorf("fetch context ended with the first scrape: %v", err)
+	}
+	<-f.done
+	if len(f.metrics) != 1 {
+		t.Errorf("fetch got %d metrics, want 1", len(f.metrics))
+	}
+}
@@ -0,0 +1,64 @@
+package collectors
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"strings"
+	"sync"
+)
+
+// counterKey identifies a counter series from an instance
+type counterKey struct {
+	metric string
+	labels string
+}
+
+// counterTracker remembers the last value of each counter series read from
+// an instance, so that a counter going backwards (a reboot or a channel being
+// reassigned) can be counted as a reset
+type counterTracker struct {
+	mutex sync.Mutex
+	last  map[string]map[counterKey]float64
+}
+
+func newCounterTracker() *counterTracker {
+	return &counterTracker{
+		last: map[string]map[counterKey]float64{},
+	}
+}
+
+// update replaces the remembered values for an instance and returns the
+// number of series of each metric that went backwards. Series no longer
+// reported are forgotten.
+func (t *counterTracker) update(instance string, values map[counterKey]float64) map[string]int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	resets := map[string]int{}
+	for key, value := range values {
+		if last, ok := t.last[instance][key]; ok && value < last {
+			resets[key.metric]++
+		}
+	}
+	t.last[instance] = values
+	return resets
+}
+
+// counterScrape gathers the counters read in a single scrape of an instance
+type counterScrape struct {
+	ch     chan<- prometheus.Metric
+	values map[counterKey]float64
+}
+
+func newCounterScrape(ch chan<- prometheus.Metric) *counterScrape {
+	return &counterScrape{
+		ch:     ch,
+		values: map[counterKey]float64{},
+	}
+}
+
+// add sends a counter and records its value, metric names the counter in
+// hub4_counter_resets_total
+func (c *counterScrape) add(desc *prometheus.Desc, metric string, value float64, labels ...string) {
+	c.ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, labels...)
+	c.values[counterKey{metric: metric, labels: strings.Join(labels, "\xff")}] = value
+}
@@ -0,0 +1,77 @@
+package collectors
+
+import (
+	"bytes"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"hub4_exporter/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCounterTrackerResets(t *testing.T) {
+	tracker := newCounterTracker()
+	key := counterKey{metric: "ds_channel_prers_errors_total", labels: "330000000"}
+	other := counterKey{metric: "ds_channel_prers_errors_total", labels: "338000000"}
+
+	// The first value of a series isn't a reset, however low
+	if resets := tracker.update("0/hub", map[counterKey]float64{key: 12}); len(resets) != 0 {
+		t.Errorf("got resets %v on the first update, want none", resets)
+	}
+	// Going up or staying the same isn't a reset, nor is a new series
+	if resets := tracker.update("0/hub", map[counterKey]float64{key: 12, other: 0}); len(resets) != 0 {
+		t.Errorf("got resets %v without a counter going backwards, want none", resets)
+	}
+	if resets := tracker.update("0/hub", map[counterKey]float64{key: 3, other: 1}); resets["ds_channel_prers_errors_total"] != 1 {
+		t.Errorf("got resets %v after a counter went backwards, want 1", resets)
+	}
+	// Other instances are tracked apart
+	if resets := tracker.update("1/hub", map[counterKey]float64{key: 1}); len(resets) != 0 {
+		t.Errorf("got resets %v on the first update of another instance, want none", resets)
+	}
+}
+
+func TestCollectCounterResets(t *testing.T) {
+	data := readTestdata(t, "hub4_networkstatus.json")
+	// The first DS channel's pre RS errors go from 12 to 3 after the first scrape
+	lowered := bytes.Replace(data, []byte(`"40.366","12"`), []byte(`"40.366","3"`), 1)
+	if bytes.Equal(data, lowered) {
+		t.Fatal("pre RS errors not found in the recorded response")
+	}
+	var scrapes int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&scrapes, 1) == 1 {
+			w.Write(data)
+			return
+		}
+		w.Write(lowered)
+	}))
+	t.Cleanup(server.Close)
+
+	conf, err := config.ConfigParse(strings.NewReader(`
+instances:
+  - name: hub
+    address: ` + strings.TrimPrefix(server.URL, "http://") + `
+    type: hub4
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := PromExporter(5*time.Second, conf)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(p)
+	resets := p.counterResets.WithLabelValues("hub", conf.Instances[0].Address, "hub4", "ds_channel_prers_errors_total")
+
+	for i, want := range []float64{0, 1, 1} {
+		if _, err := registry.Gather(); err != nil {
+			t.Fatal(err)
+		}
+		if n := testutil.ToFloat64(resets); n != want {
+			t.Errorf("scrape %d: got %v resets, want %v", i+1, n, want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package collectors
+
+import (
+	"hub4_exporter/config"
+	"sync"
+)
+
+// Parse failures in a row before an instance's modem is detected again, in
+// case the modem at the address has been swapped
+const redetectAfterFailures = 3
+
+// modelCache remembers the modem detected for each instance without a type
+type modelCache struct {
+	mutex    sync.Mutex
+	detected map[string]*detectedModel
+}
+
+type detectedModel struct {
+	instance      *config.InstancesConfig
+	parseFailures int
+}
+
+func newModelCache() *modelCache {
+	return &modelCache{
+		detected: map[string]*detectedModel{},
+	}
+}
+
+// get returns the instance with its detected type, or nil if it hasn't been
+// detected
+func (c *modelCache) get(instance *config.InstancesConfig) *config.InstancesConfig {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if detected, ok := c.detected[instance.Key]; ok {
+		return detected.instance
+	}
+	return nil
+}
+
+func (c *modelCache) set(instance *config.InstancesConfig, detected *config.InstancesConfig) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.detected[instance.Key] = &detectedModel{instance: detected}
+}
+
+// parseFailed counts a parse failure, forgetting the detected modem and
+// returning true once there have been too many in a row
+func (c *modelCache) parseFailed(instance *config.InstancesConfig) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	detected, ok := c.detected[instance.Key]
+	if !ok {
+		return false
+	}
+	detected.parseFailures++
+	if detected.parseFailures < redetectAfterFailures {
+		return false
+	}
+	delete(c.detected, instance.Key)
+	return true
+}
+
+func (c *modelCache) parseSucceeded(instance *config.InstancesConfig) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if detected, ok := c.detected[instance.Key]; ok {
+		detected.parseFailures = 0
+	}
+}
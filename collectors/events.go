@@ -0,0 +1,80 @@
+package collectors
+
+import (
+	"context"
+	"github.com/prometheus/common/log"
+	"hub4_exporter/config"
+	"hub4_exporter/drivers"
+	"hub4_exporter/hub4"
+	"sync"
+)
+
+const hub4EventLogPath = "/php/ajaxGet_device_eventlog_data.php"
+
+// eventTracker remembers the event log entries read from each instance, so
+// that entries are only counted once however many scrapes see them. The hub
+// can log the same entry more than once in a second, so each is remembered
+// with how many times it's in the log.
+type eventTracker struct {
+	mutex sync.Mutex
+	seen  map[string]map[string]int
+}
+
+func newEventTracker() *eventTracker {
+	return &eventTracker{
+		seen: map[string]map[string]int{},
+	}
+}
+
+// update replaces the remembered entries for an instance, returning the
+// entries not seen before and whether this was the first read of the log.
+// An entry in the log more times than before is returned once for each
+// extra time. Entries that have rolled off the log are forgotten.
+func (t *eventTracker) update(instance string, events []hub4.Event) ([]hub4.Event, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	last, read := t.seen[instance]
+	seen := map[string]int{}
+	var added []hub4.Event
+	for _, event := range events {
+		key := event.Time + "\xff" + event.Code + "\xff" + event.Message
+		seen[key]++
+		if seen[key] > last[key] {
+			added = append(added, event)
+		}
+	}
+	t.seen[instance] = seen
+	return added, !read
+}
+
+// collectEvents counts the new entries of a Hub 4's event log into
+// hub4_events_total, logging each. The entries already in the log when it's
+// first read are only a baseline, so that a restart of the exporter doesn't
+// count or log the log's history again; their series start at 0.
+func (p *Exporter) collectEvents(ctx context.Context, instance *config.InstancesConfig, session *drivers.Hub4Session) error {
+	body, err := session.Get(ctx, hub4EventLogPath)
+	if err != nil {
+		return err
+	}
+	events, err := hub4.DecodeEventLog(body)
+	if err != nil {
+		return err
+	}
+
+	model := p.model(instance)
+	added, first := p.events.update(instance.Key, events)
+	for _, event := range added {
+		counter := p.eventsTotal.WithLabelValues(instance.Name, instance.Address, model, event.Priority, event.Code)
+		if first {
+			continue
+		}
+		counter.Inc()
+		log.With("instance", instance.Name).
+			With("event_time", event.Time).
+			With("priority", event.Priority).
+			With("event_code", event.Code).
+			Info(event.Message)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package collectors
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"hub4_exporter/config"
+	"hub4_exporter/drivers"
+	"hub4_exporter/hub4"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Event log rows, T3 time-outs are logged in bursts within the same second
+const (
+	eventT3First  = `["17/10/2026 09:12:01","critical(3)","82000300","Ranging Request Retries exhausted"]`
+	eventT3Burst  = `["17/10/2026 09:14:27","critical(3)","82000300","Ranging Request Retries exhausted"]`
+	eventT3Later  = `["17/10/2026 09:20:45","critical(3)","82000300","Ranging Request Retries exhausted"]`
+	eventTODFirst = `["17/10/2026 09:12:05","error(4)","68000403","ToD request sent - No Response received"]`
+)
+
+func TestCollectEvents(t *testing.T) {
+	pages := map[string][]byte{}
+	server, _ := newHub4AdminServer(t, pages)
+	instance := &config.InstancesConfig{
+		Name:        "hub",
+		Address:     strings.TrimPrefix(server.URL, "http://"),
+		Key:         "0/hub",
+		Type:        "hub4",
+		Credentials: &config.CredentialsConfig{Password: "secret"},
+	}
+	p := PromExporter(5*time.Second, &config.Config{Instances: []*config.InstancesConfig{instance}})
+	session, err := drivers.NewHub4Session(http.DefaultClient, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t3 := p.eventsTotal.WithLabelValues("hub", instance.Address, "hub4", "critical", "82000300")
+	tod := p.eventsTotal.WithLabelValues("hub", instance.Address, "hub4", "error", "68000403")
+
+	read := func(rows ...string) {
+		t.Helper()
+		pages[hub4EventLogPath] = []byte("[" + strings.Join(rows, ",") + "]")
+		if err := p.collectEvents(context.Background(), instance, session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(when string, wantT3, wantToD float64) {
+		t.Helper()
+		if got := testutil.ToFloat64(t3); got != wantT3 {
+			t.Errorf("%s: got %v T3 time-outs, want %v", when, got, wantT3)
+		}
+		if got := testutil.ToFloat64(tod); got != wantToD {
+			t.Errorf("%s: got %v ToD failures, want %v", when, got, wantToD)
+		}
+	}
+
+	// The entries already in the log are a baseline, not counted
+	read(eventT3First, eventTODFirst)
+	check("first read", 0, 0)
+
+	// Only new entries are counted, including each of a burst
+	read(eventT3First, eventTODFirst, eventT3Burst, eventT3Burst)
+	check("new entries", 2, 0)
+
+	// The same entry logged again is counted again
+	read(eventT3First, eventTODFirst, eventT3Burst, eventT3Burst, eventT3Burst)
+	check("repeated entry", 3, 0)
+
+	// Entries rolling off the log don't count, or stop new ones counting
+	read(eventT3Burst, eventT3Burst, eventT3Burst, eventT3Later)
+	check("rolled off", 4, 0)
+	read(eventT3Burst, eventT3Burst, eventT3Burst, eventT3Later)
+	check("unchanged", 4, 0)
+
+	// After a restart of the exporter the log's history isn't counted again
+	p = PromExporter(5*time.Second, &config.Config{Instances: []*config.InstancesConfig{instance}})
+	t3 = p.eventsTotal.WithLabelValues("hub", instance.Address, "hub4", "critical", "82000300")
+	tod = p.eventsTotal.WithLabelValues("hub", instance.Address, "hub4", "error", "68000403")
+	read(eventT3Burst, eventT3Burst, eventT3Burst, eventT3Later)
+	check("restarted", 0, 0)
+	read(eventT3Burst, eventT3Burst, eventT3Burst, eventT3Later, eventTODFirst)
+	check("new entry after restart", 0, 1)
+}
+
+func TestEventTrackerFirstRead(t *testing.T) {
+	event := hub4.Event{Time: "17/10/2026 09:12:01", Priority: "critical", Code: "82000300", Message: "Ranging Request Retries exhausted"}
+	tracker := newEventTracker()
+
+	// The first read's entries are returned marked as the first read, so
+	// they're taken as a baseline
+	added, first := tracker.update("0/hub", []hub4.Event{event})
+	if len(added) != 1 || !first {
+		t.Errorf("got %d entries and first read %t, want 1 and true", len(added), first)
+	}
+	added, first = tracker.update("0/hub", []hub4.Event{event, event})
+	if len(added) != 1 || first {
+		t.Errorf("got %d entries and first read %t, want 1 and false", len(added), first)
+	}
+	// Other instances have their own log
+	if _, first := tracker.update("1/hub", []hub4.Event{event}); !first {
+		t.Error("another instance's first read wasn't marked as first")
+	}
+}
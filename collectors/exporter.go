@@ -1,68 +1,230 @@
 package collectors
 
 import (
-	"github.com/tidwall/gjson"
-	"fmt"
+	"context"
+	"errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/log"
 	"hub4_exporter/config"
-	"io/ioutil"
+	"hub4_exporter/drivers"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
-
 type Exporter struct {
-	mutex  sync.Mutex
-	config *config.Config
+	config  *config.Config
+	timeout time.Duration
+
+	// Scrape errors by instance and reason, kept across scrapes
+	scrapeErrors *prometheus.CounterVec
+	// Counters from instances that went backwards
+	counterResets *prometheus.CounterVec
+	counters      *counterTracker
+	// Modems detected for instances without a type
+	models *modelCache
+	// Snapshots of the instances polled in the background
+	snapshots map[string]*snapshot
+	// Circuit breakers of instances that have one
+	breakers     map[string]*circuitBreaker
+	circuitState *prometheus.Desc
+	// Fetches under way, shared by concurrent scrapes
+	fetches *coalescer
+	// Time scrapes waited for another scrape's fetch
+	scrapeWait *prometheus.HistogramVec
+	// HTTP clients and request timings by instance
+	clients    *httpClients
+	httpPhases *prometheus.HistogramVec
+	// Admin web UI sessions, and failed logins to them
+	sessions      *hub4Sessions
+	loginFailures *prometheus.CounterVec
+	// Entries of the Hub 4's event log
+	events      *eventTracker
+	eventsTotal *prometheus.CounterVec
+	// Reboots of the instance, seen by its uptime going backwards
+	uptimes *uptimeTracker
+	reboots *prometheus.CounterVec
+	// Instances whose firmware has no Wi-Fi scan
+	wifiScans *wifiScanSupport
+	// Key of the HMAC hiding serial numbers and client details
+	hashKey []byte
 
 	// Status
-	scrapeStatus       *prometheus.Desc
-	aquiredDSChannel   *prometheus.Desc
-	rangedUSChannel    *prometheus.Desc
-	provisioningStatus *prometheus.Desc
-	BPIState           *prometheus.Desc
-	maxCPE             *prometheus.Desc
-	networkAccess      *prometheus.Desc
-	DSFlowID           *prometheus.Desc
-	DOCSISVersion      *prometheus.Desc
-	USFlowID           *prometheus.Desc
-	DSTrafficRate      *prometheus.Desc
-	USTrafficRate      *prometheus.Desc
-	DSTrafficRateMin   *prometheus.Desc
-	USTrafficRateMin   *prometheus.Desc
-	DSTrafficRateBurst *prometheus.Desc
-	USTrafficRateBurst *prometheus.Desc
-	USTrafficConnBurst *prometheus.Desc
-	DSChannelPostRS    *prometheus.Desc
-	DSChannelPreRS     *prometheus.Desc
-	DSChannelSNR       *prometheus.Desc
-	DSChannelLocked    *prometheus.Desc
-	DSChannelPower     *prometheus.Desc
-	DSChannelRXMer     *prometheus.Desc
-	DSNumber31 *prometheus.Desc
-	DSNumber *prometheus.Desc
-	USNumber *prometheus.Desc
-	USNumber31 *prometheus.Desc
-	USChannelPower *prometheus.Desc
-	USChannelSymbolRate* prometheus.Desc
-	USChannelTimeouts *prometheus.Desc
-	DS31ChannelLocked *prometheus.Desc
-	DS31ChannelPLCPower *prometheus.Desc
-	DS31ChannelRXMer *prometheus.Desc
-	DS31ChannelPreRS *prometheus.Desc
-	DS31ChannelPostRS *prometheus.Desc
+	up                         *prometheus.Desc
+	lastSuccess                *prometheus.Desc
+	snapshotAge                *prometheus.Desc
+	scrapeStatus               *prometheus.Desc
+	aquiredDSChannel           *prometheus.Desc
+	rangedUSChannel            *prometheus.Desc
+	provisioningStatus         *prometheus.Desc
+	BPIState                   *prometheus.Desc
+	maxCPE                     *prometheus.Desc
+	networkAccess              *prometheus.Desc
+	DSFlowID                   *prometheus.Desc
+	DOCSISVersion              *prometheus.Desc
+	USFlowID                   *prometheus.Desc
+	DSTrafficRate              *prometheus.Desc
+	USTrafficRate              *prometheus.Desc
+	DSTrafficRateMin           *prometheus.Desc
+	USTrafficRateMin           *prometheus.Desc
+	DSTrafficRateBurst         *prometheus.Desc
+	USTrafficRateBurst         *prometheus.Desc
+	USTrafficConnBurst         *prometheus.Desc
+	DSChannelPostRS            *prometheus.Desc
+	DSChannelPreRS             *prometheus.Desc
+	DSChannelSNR               *prometheus.Desc
+	DSChannelLocked            *prometheus.Desc
+	DSChannelPower             *prometheus.Desc
+	DSChannelRXMer             *prometheus.Desc
+	DSNumber31                 *prometheus.Desc
+	DSNumber                   *prometheus.Desc
+	USNumber                   *prometheus.Desc
+	USNumber31                 *prometheus.Desc
+	USChannelPower             *prometheus.Desc
+	USChannelSymbolRate        *prometheus.Desc
+	USChannelTimeouts          *prometheus.Desc
+	US31ChannelPower           *prometheus.Desc
+	US31ChannelTimeouts        *prometheus.Desc
+	US31ChannelInfo            *prometheus.Desc
+	DS31ChannelLocked          *prometheus.Desc
+	DS31ChannelPLCPower        *prometheus.Desc
+	DS31ChannelRXMer           *prometheus.Desc
+	DS31ChannelPreRS           *prometheus.Desc
+	DS31ChannelPostRS          *prometheus.Desc
 	DS31ChannelFirstSubcarrier *prometheus.Desc
-	DS31ChannelSubcarriers *prometheus.Desc
-	DS31ChannelWidth *prometheus.Desc
+	DS31ChannelSubcarriers     *prometheus.Desc
+	DS31ChannelWidth           *prometheus.Desc
 
+	// Info
+	modemInfo              *prometheus.Desc
+	aquiredDSChannelStatus *prometheus.Desc
+	rangedUSChannelStatus  *prometheus.Desc
+	DSChannelInfo          *prometheus.Desc
+	USChannelInfo          *prometheus.Desc
+	DS31ChannelInfo        *prometheus.Desc
+	uptime                 *prometheus.Desc
+	bootTime               *prometheus.Desc
+	systemInfo             *prometheus.Desc
+	connectedClients       *prometheus.Desc
+	clientInfo             *prometheus.Desc
+	wifiRadioInfo          *prometheus.Desc
+	wifiRadioEnabled       *prometheus.Desc
+	wifiRadioClients       *prometheus.Desc
+	wifiNeighbours         *prometheus.Desc
+	wifiNeighbourSignal    *prometheus.Desc
 }
+
 var namespace = "hub4"
 
 func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
-	return &Exporter{
-		config: conf,
+	exporter := &Exporter{
+		config:  conf,
+		timeout: timeout,
+		scrapeErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "scrape",
+				Name:      "errors_total",
+				Help:      "Scrape errors by reason",
+			},
+			[]string{"instance", "address", "model", "reason"},
+		),
+		counterResets: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "counter_resets_total",
+				Help:      "Counter series from the instance that went backwards, by metric",
+			},
+			[]string{"instance", "address", "model", "metric"},
+		),
+		counters:  newCounterTracker(),
+		models:    newModelCache(),
+		snapshots: map[string]*snapshot{},
+		fetches:   newCoalescer(),
+		breakers:  map[string]*circuitBreaker{},
+		circuitState: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"circuit",
+				"state",
+			),
+			"State of the instance's circuit breaker, 0 closed, 1 open or 2 half open",
+			[]string{"instance", "address"},
+			nil,
+		),
+		scrapeWait: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: "scrape",
+				Name:      "wait_seconds",
+				Help:      "Time scrapes of the instance waited for a fetch started by another scrape",
+				Buckets:   prometheus.DefBuckets,
+			},
+			[]string{"instance", "address"},
+		),
+		clients:    newHTTPClients(),
+		httpPhases: newHTTPPhases(),
+		sessions:   newHub4Sessions(),
+		loginFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "login_failures_total",
+				Help:      "Failed logins to the instance's admin web UI",
+			},
+			[]string{"instance", "address", "model"},
+		),
+		events: newEventTracker(),
+		eventsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "events_total",
+				Help:      "Entries added to the instance's event log since the exporter started, by priority and DOCSIS event code",
+			},
+			[]string{"instance", "address", "model", "priority", "event_code"},
+		),
+		uptimes:   newUptimeTracker(),
+		wifiScans: newWifiScanSupport(),
+		hashKey:   newHashKey(conf),
+		reboots: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "reboots_total",
+				Help:      "Reboots of the instance, seen by its uptime going backwards",
+			},
+			[]string{"instance", "address", "model"},
+		),
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"up",
+			),
+			"Was the last scrape of the instance successful",
+			[]string{"instance", "address", "model"},
+			nil,
+		),
+		lastSuccess: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"last_success_timestamp_seconds",
+			),
+			"When the instance was last polled successfully",
+			[]string{"instance", "address", "model"},
+			nil,
+		),
+		snapshotAge: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"snapshot",
+				"age_seconds",
+			),
+			"Age of the polled metrics of the instance",
+			[]string{"instance", "address", "model"},
+			nil,
+		),
 		scrapeStatus: prometheus.NewDesc(
 			prometheus.BuildFQName(
 				namespace,
@@ -70,7 +232,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"status",
 			),
 			"Scrape Status",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		aquiredDSChannel: prometheus.NewDesc(
@@ -80,7 +242,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"aquired_DS_channel",
 			),
 			"Acquired Downstream Channel Frequency (Hz)",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		rangedUSChannel: prometheus.NewDesc(
@@ -90,7 +252,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ranged_US_channel",
 			),
 			"Ranged (discovered) Upstream Channel Frequency (Hz)",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		provisioningStatus: prometheus.NewDesc(
@@ -100,7 +262,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"provisioning_status",
 			),
 			"Provisioning Status",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		networkAccess: prometheus.NewDesc(
@@ -110,7 +272,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"network_access",
 			),
 			"Network Access",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		maxCPE: prometheus.NewDesc(
@@ -120,7 +282,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"max_cpe",
 			),
 			"Maximum CPE devices",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		BPIState: prometheus.NewDesc(
@@ -130,7 +292,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"bpi_state",
 			),
 			"BPI State",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		DOCSISVersion: prometheus.NewDesc(
@@ -140,7 +302,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"docsis_version",
 			),
 			"Docsis version",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		DSFlowID: prometheus.NewDesc(
@@ -150,7 +312,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds_flow_id",
 			),
 			"DS Flow ID",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		USFlowID: prometheus.NewDesc(
@@ -160,7 +322,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"us_flow_id",
 			),
 			"US Flow ID",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		DSTrafficRate: prometheus.NewDesc(
@@ -170,7 +332,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds_traffic_rate",
 			),
 			"DS Traffic Rate (max)",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		USTrafficRate: prometheus.NewDesc(
@@ -180,7 +342,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"us_traffic_rate",
 			),
 			"US Traffic Rate (max)",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		DSTrafficRateBurst: prometheus.NewDesc(
@@ -190,7 +352,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds_traffic_rate_burst",
 			),
 			"DS Traffic Rate (burst)",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		USTrafficRateBurst: prometheus.NewDesc(
@@ -200,7 +362,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"us_traffic_rate_burst",
 			),
 			"US Traffic Rate (busrt)",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		DSTrafficRateMin: prometheus.NewDesc(
@@ -210,7 +372,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds_traffic_rate_min",
 			),
 			"DS Traffic Rate (min)",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		USTrafficRateMin: prometheus.NewDesc(
@@ -220,7 +382,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"us_traffic_rate_min",
 			),
 			"US Traffic Rate (min)",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		USTrafficConnBurst: prometheus.NewDesc(
@@ -230,7 +392,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"us_concatenated_burst",
 			),
 			"US Concatenated Burst",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		DSChannelPower: prometheus.NewDesc(
@@ -240,7 +402,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds_channel_power",
 			),
 			"DS Channel Power (dBmV)",
-			[]string{"instance", "address", "frequency"},
+			[]string{"instance", "address", "model", "frequency"},
 			nil,
 		),
 		DSChannelSNR: prometheus.NewDesc(
@@ -250,7 +412,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds_channel_snr",
 			),
 			"DS Channel SNR (dB)",
-			[]string{"instance", "address", "frequency"},
+			[]string{"instance", "address", "model", "frequency"},
 			nil,
 		),
 		DSChannelLocked: prometheus.NewDesc(
@@ -260,27 +422,27 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds_channel_locked",
 			),
 			"DS Channel Locked",
-			[]string{"instance", "address", "frequency"},
+			[]string{"instance", "address", "model", "frequency"},
 			nil,
 		),
 		DSChannelPreRS: prometheus.NewDesc(
 			prometheus.BuildFQName(
 				namespace,
 				"",
-				"ds_channel_prers_errors",
+				"ds_channel_prers_errors_total",
 			),
 			"DS Channel Recoverable Errors (Pre RS)",
-			[]string{"instance", "address", "frequency"},
+			[]string{"instance", "address", "model", "frequency"},
 			nil,
 		),
 		DSChannelPostRS: prometheus.NewDesc(
 			prometheus.BuildFQName(
 				namespace,
 				"",
-				"ds_channel_postrs_errors",
+				"ds_channel_postrs_errors_total",
 			),
 			"DS Channel Unrecoverable Errors (Post RS)",
-			[]string{"instance", "address", "frequency"},
+			[]string{"instance", "address", "model", "frequency"},
 			nil,
 		),
 		DSChannelRXMer: prometheus.NewDesc(
@@ -290,7 +452,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds_channel_rxmer",
 			),
 			"DS Channel RXMer (dB)",
-			[]string{"instance", "address", "frequency"},
+			[]string{"instance", "address", "model", "frequency"},
 			nil,
 		),
 		USNumber: prometheus.NewDesc(
@@ -300,7 +462,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"us_channel_count",
 			),
 			"US Channel count",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		DSNumber: prometheus.NewDesc(
@@ -310,7 +472,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds_channel_count",
 			),
 			"DS Channel count",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		USNumber31: prometheus.NewDesc(
@@ -320,7 +482,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"us31_channel_count",
 			),
 			"US 3.1 Channel count",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		DSNumber31: prometheus.NewDesc(
@@ -330,7 +492,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds31_channel_count",
 			),
 			"DS 3.1 Channel count",
-			[]string{"instance", "address"},
+			[]string{"instance", "address", "model"},
 			nil,
 		),
 		USChannelPower: prometheus.NewDesc(
@@ -340,17 +502,47 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"us_channel_power",
 			),
 			"US Channel Power dBmV",
-			[]string{"instance", "address", "frequency"},
+			[]string{"instance", "address", "model", "frequency"},
 			nil,
 		),
 		USChannelTimeouts: prometheus.NewDesc(
 			prometheus.BuildFQName(
 				namespace,
 				"",
-				"us_channel_timeouts",
+				"us_channel_timeouts_total",
 			),
 			"US Channel Timeouts",
-			[]string{"instance", "address", "frequency", "timeout_class"},
+			[]string{"instance", "address", "model", "frequency", "timeout_class"},
+			nil,
+		),
+		US31ChannelPower: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"us31_channel_power",
+			),
+			"US 3.1 Channel Power dBmV",
+			[]string{"instance", "address", "model", "frequency"},
+			nil,
+		),
+		US31ChannelTimeouts: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"us31_channel_timeouts_total",
+			),
+			"US 3.1 Channel Timeouts",
+			[]string{"instance", "address", "model", "frequency", "timeout_class"},
+			nil,
+		),
+		US31ChannelInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"us31_channel_info",
+			),
+			"US 3.1 Channel modulation, type and FFT type, always 1",
+			[]string{"instance", "address", "model", "frequency", "modulation", "channel_type", "fft"},
 			nil,
 		),
 
@@ -361,7 +553,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds31_channel_rxmer",
 			),
 			"DS 3.1 Channel RXMer (dB)",
-			[]string{"instance", "address", "id"},
+			[]string{"instance", "address", "model", "id", "start_frequency", "end_frequency"},
 			nil,
 		),
 		DS31ChannelPLCPower: prometheus.NewDesc(
@@ -371,11 +563,10 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds31_channel_plc_power",
 			),
 			"DS 3.1 Channel PLC Power (dBmV)",
-			[]string{"instance", "address", "id"},
+			[]string{"instance", "address", "model", "id", "start_frequency", "end_frequency"},
 			nil,
 		),
 
-
 		DS31ChannelLocked: prometheus.NewDesc(
 			prometheus.BuildFQName(
 				namespace,
@@ -383,27 +574,27 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds31_channel_locked",
 			),
 			"DS 3.1 Channel Locked",
-			[]string{"instance", "address", "id"},
+			[]string{"instance", "address", "model", "id", "start_frequency", "end_frequency"},
 			nil,
 		),
 		DS31ChannelPreRS: prometheus.NewDesc(
 			prometheus.BuildFQName(
 				namespace,
 				"",
-				"ds31_channel_prers_errors",
+				"ds31_channel_prers_errors_total",
 			),
 			"DS 3.1 Channel Recoverable Errors (Pre RS)",
-			[]string{"instance", "address", "id"},
+			[]string{"instance", "address", "model", "id", "start_frequency", "end_frequency"},
 			nil,
 		),
 		DS31ChannelPostRS: prometheus.NewDesc(
 			prometheus.BuildFQName(
 				namespace,
 				"",
-				"ds31_channel_postrs_errors",
+				"ds31_channel_postrs_errors_total",
 			),
-			"DS 3.1 Channel Unrecoverable Errors (Pre RS)",
-			[]string{"instance", "address", "id"},
+			"DS 3.1 Channel Unrecoverable Errors (Post RS)",
+			[]string{"instance", "address", "model", "id", "start_frequency", "end_frequency"},
 			nil,
 		),
 		DS31ChannelFirstSubcarrier: prometheus.NewDesc(
@@ -413,7 +604,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds31_channel_first_subcarrier",
 			),
 			"DS 3.1 Channel First Subcarrier (Hz)",
-			[]string{"instance", "address", "id"},
+			[]string{"instance", "address", "model", "id", "start_frequency", "end_frequency"},
 			nil,
 		),
 		DS31ChannelSubcarriers: prometheus.NewDesc(
@@ -423,7 +614,7 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds31_channel_subcarriers",
 			),
 			"DS 3.1 Channel Subcarriers",
-			[]string{"instance", "address", "id"},
+			[]string{"instance", "address", "model", "id", "start_frequency", "end_frequency"},
 			nil,
 		),
 		DS31ChannelWidth: prometheus.NewDesc(
@@ -433,24 +624,397 @@ func PromExporter(timeout time.Duration, conf *config.Config) *Exporter {
 				"ds31_channel_width",
 			),
 			"DS 3.1 Channel Width (MHz)",
-			[]string{"instance", "address", "id"},
+			[]string{"instance", "address", "model", "id", "start_frequency", "end_frequency"},
+			nil,
+		),
+		modemInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"modem_info",
+			),
+			"Modem information, always 1",
+			[]string{"instance", "address", "model", "docsis_version", "boot_file", "scheduling_type", "primary_channel_type"},
+			nil,
+		),
+		aquiredDSChannelStatus: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"aquired_DS_channel_status",
+			),
+			"Acquired Downstream Channel Status, 1 for the current state",
+			[]string{"instance", "address", "model", "state"},
+			nil,
+		),
+		rangedUSChannelStatus: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"ranged_US_channel_status",
+			),
+			"Ranged Upstream Channel Status, 1 for the current state",
+			[]string{"instance", "address", "model", "state"},
+			nil,
+		),
+		DSChannelInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"ds_channel_info",
+			),
+			"DS Channel modulation, always 1",
+			[]string{"instance", "address", "model", "frequency", "modulation"},
+			nil,
+		),
+		USChannelInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"us_channel_info",
+			),
+			"US Channel modulation, symbol rate and type, always 1",
+			[]string{"instance", "address", "model", "frequency", "modulation", "symbol_rate", "channel_type"},
+			nil,
+		),
+		DS31ChannelInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"ds31_channel_info",
+			),
+			"DS 3.1 Channel FFT type and modulation, always 1",
+			[]string{"instance", "address", "model", "id", "start_frequency", "end_frequency", "fft", "modulation"},
+			nil,
+		),
+		uptime: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"uptime_seconds",
+			),
+			"Time since the instance booted",
+			[]string{"instance", "address", "model"},
+			nil,
+		),
+		bootTime: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"boot_time_seconds",
+			),
+			"When the instance booted",
+			[]string{"instance", "address", "model"},
+			nil,
+		),
+		systemInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"system_info",
+			),
+			"System information, always 1",
+			[]string{"instance", "address", "model", "firmware", "hardware_model", "hardware_version", "serial"},
 			nil,
 		),
+		connectedClients: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"connected_clients",
+			),
+			"Devices connected to the instance, by interface and Wi-Fi band",
+			[]string{"instance", "address", "model", "interface", "band"},
+			nil,
+		),
+		clientInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"",
+				"client_info",
+			),
+			"A device connected to the instance, always 1",
+			[]string{"instance", "address", "model", "mac_hash", "hostname", "ip", "interface"},
+			nil,
+		),
+		wifiRadioInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"wifi",
+				"radio_info",
+			),
+			"Wi-Fi radio settings, always 1",
+			[]string{"instance", "address", "model", "radio", "band", "channel", "bandwidth", "mode"},
+			nil,
+		),
+		wifiRadioEnabled: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"wifi",
+				"radio_enabled",
+			),
+			"Is the Wi-Fi radio enabled",
+			[]string{"instance", "address", "model", "radio", "band"},
+			nil,
+		),
+		wifiRadioClients: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"wifi",
+				"radio_clients",
+			),
+			"Devices connected to the Wi-Fi radio",
+			[]string{"instance", "address", "model", "radio", "band"},
+			nil,
+		),
+		wifiNeighbours: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"wifi",
+				"neighbour_networks",
+			),
+			"Networks found by the Wi-Fi scan, by channel",
+			[]string{"instance", "address", "model", "band", "channel"},
+			nil,
+		),
+		wifiNeighbourSignal: prometheus.NewDesc(
+			prometheus.BuildFQName(
+				namespace,
+				"wifi",
+				"neighbour_signal_strongest_dbm",
+			),
+			"Signal of the strongest network found by the Wi-Fi scan, by channel",
+			[]string{"instance", "address", "model", "band", "channel"},
+			nil,
+		),
+	}
+
+	for _, instance := range conf.Instances {
+		if exporter.pollInterval(instance) > 0 {
+			exporter.snapshots[instance.Key] = &snapshot{}
+		}
+		if conf := exporter.breakerConfig(instance); conf != nil {
+			exporter.breakers[instance.Key] = newCircuitBreaker(instance.Name, conf)
+		}
+	}
 
+	// Instances to be detected are started once their modem is known
+	for _, instance := range conf.Instances {
+		if !drivers.IsAuto(instance.Type) {
+			exporter.initScrapeErrors(instance)
+		}
+	}
+	return exporter
+}
+
+// initScrapeErrors starts an instance's error counters at zero so rate()
+// works from the first error
+func (p *Exporter) initScrapeErrors(instance *config.InstancesConfig) {
+	model := p.model(instance)
+	for _, reason := range drivers.Reasons {
+		p.scrapeErrors.WithLabelValues(instance.Name, instance.Address, model, reason)
+	}
+	if instance.Type == "hub4" && instance.Credentials != nil {
+		p.loginFailures.WithLabelValues(instance.Name, instance.Address, model)
+		p.reboots.WithLabelValues(instance.Name, instance.Address, model)
+	}
+}
 
+// DetectModels detects the modem of each instance without a type, instances
+// that can't be detected now are tried again when scraped
+func (p *Exporter) DetectModels(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for _, instance := range p.config.Instances {
+		if !drivers.IsAuto(instance.Type) {
+			continue
+		}
+		wg.Add(1)
+		go func(instance *config.InstancesConfig) {
+			defer wg.Done()
+			instanceCtx, cancel := context.WithTimeout(ctx, p.instanceTimeout(instance))
+			defer cancel()
+			httpClient, err := p.httpClient(instance)
+			if err != nil {
+				log.Warnf("Unable to detect the modem of instance %s: %s", instance.Name, err)
+				return
+			}
+			if _, err := p.detect(instanceCtx, httpClient, instance, false); err != nil {
+				log.Warnf("Unable to detect the modem of instance %s: %s", instance.Name, err)
+			}
+		}(instance)
 	}
+	wg.Wait()
 }
 
+// detect returns the instance with its detected type, detecting it if it
+// isn't cached
+func (p *Exporter) detect(ctx context.Context, httpClient *http.Client, instance *config.InstancesConfig, probe bool) (*config.InstancesConfig, error) {
+	// Probe targets aren't cached, as there's no limit to how many there are
+	// and one could share a configured instance's name
+	if probe {
+		return drivers.Detect(ctx, httpClient, instance)
+	}
+	if detected := p.models.get(instance); detected != nil {
+		return detected, nil
+	}
+	detected, err := drivers.Detect(ctx, httpClient, instance)
+	if err != nil {
+		return nil, err
+	}
+	p.models.set(instance, detected)
+	log.Infof("Detected %s modem for instance %s", p.model(detected), instance.Name)
+	p.initScrapeErrors(detected)
+	return detected, nil
+}
 
 func (p *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	p.scrapeErrors.Describe(ch)
+	p.scrapeWait.Describe(ch)
+	p.loginFailures.Describe(ch)
+	p.eventsTotal.Describe(ch)
+	p.reboots.Describe(ch)
+	p.httpPhases.Describe(ch)
+	p.counterResets.Describe(ch)
+	ch <- p.up
+	ch <- p.circuitState
+	ch <- p.lastSuccess
+	ch <- p.snapshotAge
 	ch <- p.scrapeStatus
+	ch <- p.aquiredDSChannel
+	ch <- p.rangedUSChannel
+	ch <- p.provisioningStatus
+	ch <- p.BPIState
+	ch <- p.maxCPE
+	ch <- p.networkAccess
+	ch <- p.DSFlowID
+	ch <- p.DOCSISVersion
+	ch <- p.USFlowID
+	ch <- p.DSTrafficRate
+	ch <- p.USTrafficRate
+	ch <- p.DSTrafficRateMin
+	ch <- p.USTrafficRateMin
+	ch <- p.DSTrafficRateBurst
+	ch <- p.USTrafficRateBurst
+	ch <- p.USTrafficConnBurst
+	ch <- p.DSChannelPostRS
+	ch <- p.DSChannelPreRS
+	ch <- p.DSChannelSNR
+	ch <- p.DSChannelLocked
+	ch <- p.DSChannelPower
+	ch <- p.DSChannelRXMer
+	ch <- p.DSNumber31
+	ch <- p.DSNumber
+	ch <- p.USNumber
+	ch <- p.USNumber31
+	ch <- p.USChannelPower
+	ch <- p.USChannelTimeouts
+	ch <- p.US31ChannelPower
+	ch <- p.US31ChannelTimeouts
+	ch <- p.US31ChannelInfo
+	ch <- p.DS31ChannelLocked
+	ch <- p.DS31ChannelPLCPower
+	ch <- p.DS31ChannelRXMer
+	ch <- p.DS31ChannelPreRS
+	ch <- p.DS31ChannelPostRS
+	ch <- p.DS31ChannelFirstSubcarrier
+	ch <- p.DS31ChannelSubcarriers
+	ch <- p.DS31ChannelWidth
+	ch <- p.modemInfo
+	ch <- p.aquiredDSChannelStatus
+	ch <- p.rangedUSChannelStatus
+	ch <- p.DSChannelInfo
+	ch <- p.USChannelInfo
+	ch <- p.DS31ChannelInfo
+	ch <- p.uptime
+	ch <- p.bootTime
+	ch <- p.systemInfo
+	ch <- p.connectedClients
+	ch <- p.clientInfo
+	ch <- p.wifiRadioInfo
+	ch <- p.wifiRadioEnabled
+	ch <- p.wifiRadioClients
+	ch <- p.wifiNeighbours
+	ch <- p.wifiNeighbourSignal
 }
 
 func (p *Exporter) Collect(ch chan<- prometheus.Metric) {
+	p.collect(context.Background(), ch)
+}
+
+// WithContext returns a collector for a single scrape, the scrape's
+// instances are cancelled along with ctx
+func (p *Exporter) WithContext(ctx context.Context) prometheus.Collector {
+	return &contextCollector{exporter: p, ctx: ctx}
+}
+
+type contextCollector struct {
+	exporter *Exporter
+	ctx      context.Context
+}
+
+func (c *contextCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.exporter.Describe(ch)
+}
 
-	// Lock so no more than 1 collect occurs at once
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
+func (c *contextCollector) Collect(ch chan<- prometheus.Metric) {
+	c.exporter.collect(c.ctx, ch)
+}
+
+// Probe returns a collector for a single scrape of a target that isn't one
+// of the configured instances
+func (p *Exporter) Probe(ctx context.Context, instance *config.InstancesConfig) prometheus.Collector {
+	return &probeCollector{exporter: p, ctx: ctx, instance: instance}
+}
+
+type probeCollector struct {
+	exporter *Exporter
+	ctx      context.Context
+	instance *config.InstancesConfig
+}
+
+func (c *probeCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.exporter.Describe(ch)
+}
+
+func (c *probeCollector) Collect(ch chan<- prometheus.Metric) {
+	// Probes get a client of their own, with timings only for the probe
+	phases := newHTTPPhases()
+	httpClient, err := c.exporter.newHTTPClient(c.instance, phases)
+	if err != nil {
+		c.exporter.scrapeFailed(ch, c.instance, drivers.ReasonConnectionError, err, true)
+		return
+	}
+	defer httpClient.CloseIdleConnections()
+	c.exporter.collectInstance(c.ctx, ch, c.instance, httpClient, true)
+	phases.Collect(ch)
+}
+
+// model returns the modem model of an instance, used for the model label.
+// HTML modems are labelled with their html model, and instances whose modem
+// hasn't been detected yet as unknown.
+func (p *Exporter) model(instance *config.InstancesConfig) string {
+	if drivers.IsAuto(instance.Type) {
+		detected := p.models.get(instance)
+		if detected == nil {
+			return "unknown"
+		}
+		instance = detected
+	}
+	if instance.Type == "html" && instance.HTML != nil && instance.HTML.Model != "" {
+		return strings.ToLower(instance.HTML.Model)
+	}
+	return instance.Type
+}
+
+// instanceTimeout returns the instance's timeout, falling back to the default
+func (p *Exporter) instanceTimeout(instance *config.InstancesConfig) time.Duration {
+	if instance.Timeout > 0 {
+		return instance.Timeout
+	}
+	return p.timeout
+}
+
+func (p *Exporter) collect(ctx context.Context, ch chan<- prometheus.Metric) {
 
 	// Create a wait group the size of the number of configured instances
 	instanceWG := sync.WaitGroup{}
@@ -458,257 +1022,260 @@ func (p *Exporter) Collect(ch chan<- prometheus.Metric) {
 
 	for _, instance := range p.config.Instances {
 		go func(instance *config.InstancesConfig) {
-			log.Infof("Collecting for instance path: %s", instance.Name)
-			// Make a HTTP client
-			var httpClient = &http.Client{
-				Timeout: time.Second * 30,
+			defer instanceWG.Done()
+			if snapshot, ok := p.snapshots[instance.Key]; ok {
+				// Polled instances are served from their snapshot
+				p.collectSnapshot(ch, instance, snapshot)
+			} else {
+				// Scrapes of an instance already being fetched share its
+				// metrics, the fetch is limited to the earliest of their
+				// timeouts
+				start := time.Now()
+				metrics, waited, err := p.fetches.do(ctx, instance.Key, p.instanceTimeout(instance), func(ctx context.Context) []prometheus.Metric {
+					metrics, _ := p.gatherInstance(ctx, instance)
+					return metrics
+				})
+				if waited {
+					p.scrapeWait.WithLabelValues(instance.Name, instance.Address).Observe(time.Since(start).Seconds())
+				}
+				// A timeout of the modem is counted by the fetch itself, once
+				// however many scrapes waited for it, and a scrape cancelled
+				// by its client isn't the modem's fault
+				if errors.Is(err, context.DeadlineExceeded) {
+					log.Errorf("Scrape of instance %s timed out", instance.Name)
+					ch <- prometheus.MustNewConstMetric(p.up, prometheus.GaugeValue, float64(0), instance.Name, instance.Address, p.model(instance))
+				} else if err != nil {
+					log.Debugf("Scrape of instance %s cancelled: %s", instance.Name, err)
+				}
+				for _, metric := range metrics {
+					ch <- metric
+				}
 			}
-			// Get Docsis Stats
-			response, err := httpClient.Get(fmt.Sprintf("http://%s/php/ajaxGet_device_networkstatus_data.php", instance.Address))
-			if err != nil {
-				fmt.Println(err)
+			if breaker, ok := p.breakers[instance.Key]; ok {
+				ch <- prometheus.MustNewConstMetric(p.circuitState, prometheus.GaugeValue, float64(breaker.currentState()), instance.Name, instance.Address)
 			}
+		}(instance)
+	}
+	// Wait for all instances to complete their poll
+	instanceWG.Wait()
 
-			defer response.Body.Close()
-			body, err := ioutil.ReadAll(response.Body)
-			if err != nil {
-				fmt.Println(err)
-			}
+	p.scrapeErrors.Collect(ch)
+	p.counterResets.Collect(ch)
+	p.scrapeWait.Collect(ch)
+	p.loginFailures.Collect(ch)
+	p.eventsTotal.Collect(ch)
+	p.reboots.Collect(ch)
+	p.httpPhases.Collect(ch)
+}
 
-			// Scrape Status
-			ch <- prometheus.MustNewConstMetric(p.scrapeStatus, prometheus.GaugeValue, float64(1), instance.Name, instance.Address)
-			// Data is
-			// 0 - Acquired DS Channel
+// collectInstance collects the metrics of one instance using httpClient,
+// returning whether it was successful. Probes of a target don't count scrape errors or counter
+// resets, as the target is only known for the one request.
+func (p *Exporter) collectInstance(ctx context.Context, ch chan<- prometheus.Metric, instance *config.InstancesConfig, httpClient *http.Client, probe bool) bool {
+	log.Infof("Collecting for instance path: %s", instance.Name)
+	// Limit the instance to its timeout, or the scrape's if shorter
+	instanceCtx, cancel := context.WithTimeout(ctx, p.instanceTimeout(instance))
+	defer cancel()
+	// Fail fast while the instance's circuit breaker is open
+	breaker := p.breakers[instance.Key]
+	if probe {
+		breaker = nil
+	}
+	if !breaker.allow() {
+		p.scrapeFailed(ch, instance, drivers.ReasonCircuitOpen, errCircuitOpen, probe)
+		return false
+	}
+	// Detect the modem of instances without a type
+	auto := drivers.IsAuto(instance.Type)
+	if auto {
+		detected, err := p.detect(instanceCtx, httpClient, instance, probe)
+		if err != nil {
+			breaker.failure()
+			p.scrapeFailed(ch, instance, drivers.ErrorReason(err), err, probe)
+			return false
+		}
+		instance = detected
+	}
+	model := p.model(instance)
+	driver, err := drivers.Get(instance.Type)
+	if err != nil {
+		breaker.failure()
+		p.scrapeFailed(ch, instance, drivers.ReasonConnectionError, err, probe)
+		return false
+	}
+	// Get Docsis Stats
+	body, err := p.fetch(instanceCtx, driver, httpClient, instance)
+	if err != nil {
+		breaker.failure()
+		p.scrapeFailed(ch, instance, drivers.ErrorReason(err), err, probe)
+		return false
+	}
+	breaker.success()
+	status, err := driver.Decode(instance, body)
+	if err != nil {
+		p.scrapeFailed(ch, instance, drivers.ReasonParseError, err, probe)
+		if auto && !probe && p.models.parseFailed(instance) {
+			log.Warnf("Instance %s failed to parse %d times in a row, detecting its modem again", instance.Name, redetectAfterFailures)
+		}
+		return false
+	}
+	if auto && !probe {
+		p.models.parseSucceeded(instance)
+	}
+	ch <- prometheus.MustNewConstMetric(p.up, prometheus.GaugeValue, float64(1), instance.Name, instance.Address, model)
+	counters := newCounterScrape(ch)
 
-			value := gjson.Get(string(body), "0")
-			ch <- prometheus.MustNewConstMetric(p.aquiredDSChannel, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
+	// Scrape Status
+	ch <- prometheus.MustNewConstMetric(p.scrapeStatus, prometheus.GaugeValue, float64(1), instance.Name, instance.Address, model)
 
-			// 1 - Ranged US Channel
-			value = gjson.Get(string(body), "1")
-			ch <- prometheus.MustNewConstMetric(p.rangedUSChannel, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
+	if modem := status.Modem; modem != nil {
+		ch <- prometheus.MustNewConstMetric(p.aquiredDSChannel, prometheus.GaugeValue, float64(modem.AcquiredDSChannel), instance.Name, instance.Address, model)
+		ch <- prometheus.MustNewConstMetric(p.rangedUSChannel, prometheus.GaugeValue, float64(modem.RangedUSChannel), instance.Name, instance.Address, model)
+		p.collectStateSet(ch, p.aquiredDSChannelStatus, aquiredDSChannelStates, modem.AcquiredDSChannelStatus, instance)
+		p.collectStateSet(ch, p.rangedUSChannelStatus, rangedUSChannelStates, modem.RangedUSChannelStatus, instance)
+		ch <- prometheus.MustNewConstMetric(p.provisioningStatus, prometheus.GaugeValue, modem.ProvisioningState, instance.Name, instance.Address, model)
+		ch <- prometheus.MustNewConstMetric(p.networkAccess, prometheus.GaugeValue, boolToFloat(modem.NetworkAccess), instance.Name, instance.Address, model)
+		ch <- prometheus.MustNewConstMetric(p.maxCPE, prometheus.GaugeValue, modem.MaxCPE, instance.Name, instance.Address, model)
+		ch <- prometheus.MustNewConstMetric(p.BPIState, prometheus.GaugeValue, boolToFloat(modem.BPIState), instance.Name, instance.Address, model)
+		ch <- prometheus.MustNewConstMetric(p.DOCSISVersion, prometheus.GaugeValue, modem.DOCSISVersion, instance.Name, instance.Address, model)
+		ch <- prometheus.MustNewConstMetric(p.modemInfo, prometheus.GaugeValue, float64(1), instance.Name, instance.Address, model,
+			strconv.FormatFloat(modem.DOCSISVersion, 'f', 1, 64), modem.BootFile, modem.SchedulingType, modem.PrimaryChannelType)
+	} else {
+		// Other modems only report their model
+		ch <- prometheus.MustNewConstMetric(p.modemInfo, prometheus.GaugeValue, float64(1), instance.Name, instance.Address, model, "", "", "", "")
+	}
 
-			// 2 - Acquired DS Channel Status
-			// TODO: Map Text to Numeric?
-			//value = gjson.Get(string(body), "2")
-			//fmt.Printf("AQ DS Channel Status: %s\n", value)
+	// Service flows
+	if flows := status.ServiceFlows; flows != nil {
+		ch <- prometheus.MustNewConstMetric(p.DSFlowID, prometheus.GaugeValue, flows.DSFlowID, instance.Name, instance.Address, model)
+		ch <- prometheus.MustNewConstMetric(p.DSTrafficRate, prometheus.GaugeValue, flows.DSMaxTrafficRate, instance.Name, instance.Address, model)
+		ch <- prometheus.MustNewConstMetric(p.DSTrafficRateBurst, prometheus.GaugeValue, flows.DSMaxTrafficBurst, instance.Name, instance.Address, model)
+		ch <- prometheus.MustNewConstMetric(p.DSTrafficRateMin, prometheus.GaugeValue, flows.DSMinTrafficRate, instance.Name, instance.Address, model)
+		ch <- prometheus.MustNewConstMetric(p.USFlowID, prometheus.GaugeValue, flows.USFlowID, instance.Name, instance.Address, model)
+		ch <- prometheus.MustNewConstMetric(p.USTrafficRate, prometheus.GaugeValue, flows.USMaxTrafficRate, instance.Name, instance.Address, model)
+		ch <- prometheus.MustNewConstMetric(p.USTrafficRateBurst, prometheus.GaugeValue, flows.USMaxTrafficBurst, instance.Name, instance.Address, model)
+		ch <- prometheus.MustNewConstMetric(p.USTrafficRateMin, prometheus.GaugeValue, flows.USMinTrafficRate, instance.Name, instance.Address, model)
+		ch <- prometheus.MustNewConstMetric(p.USTrafficConnBurst, prometheus.GaugeValue, flows.USMaxConcatenatedBurst, instance.Name, instance.Address, model)
+	}
 
-			// 3 - Ranged US Channel status
-			// TODO: Map Text to Numeric?
-			//value = gjson.Get(string(body), "3")
-			//fmt.Printf("Ranged DS Channel Status: %s\n", value)
+	// DS Channels
+	for _, channel := range status.DSChannels {
+		freq := strconv.FormatInt(channel.Frequency, 10)
+		ch <- prometheus.MustNewConstMetric(p.DSChannelPower, prometheus.GaugeValue, channel.Power, instance.Name, instance.Address, model, freq)
+		ch <- prometheus.MustNewConstMetric(p.DSChannelSNR, prometheus.GaugeValue, channel.SNR, instance.Name, instance.Address, model, freq)
+		ch <- prometheus.MustNewConstMetric(p.DSChannelLocked, prometheus.GaugeValue, boolToFloat(channel.Locked), instance.Name, instance.Address, model, freq)
+		ch <- prometheus.MustNewConstMetric(p.DSChannelRXMer, prometheus.GaugeValue, channel.RxMER, instance.Name, instance.Address, model, freq)
+		counters.add(p.DSChannelPreRS, "ds_channel_prers_errors_total", channel.PreRSErrors, instance.Name, instance.Address, model, freq)
+		counters.add(p.DSChannelPostRS, "ds_channel_postrs_errors_total", channel.PostRSErrors, instance.Name, instance.Address, model, freq)
+		ch <- prometheus.MustNewConstMetric(p.DSChannelInfo, prometheus.GaugeValue, float64(1), instance.Name, instance.Address, model, freq, channel.Modulation)
+	}
 
-			// 4 - Provisioning State
-			value = gjson.Get(string(body), "4")
-			ch <- prometheus.MustNewConstMetric(p.provisioningStatus, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
+	// US Channels
+	for _, channel := range status.USChannels {
+		freq := strconv.FormatInt(channel.Frequency, 10)
+		ch <- prometheus.MustNewConstMetric(p.USChannelPower, prometheus.GaugeValue, channel.Power, instance.Name, instance.Address, model, freq)
+		counters.add(p.USChannelTimeouts, "us_channel_timeouts_total", channel.T1Timeouts, instance.Name, instance.Address, model, freq, "1")
+		counters.add(p.USChannelTimeouts, "us_channel_timeouts_total", channel.T2Timeouts, instance.Name, instance.Address, model, freq, "2")
+		counters.add(p.USChannelTimeouts, "us_channel_timeouts_total", channel.T3Timeouts, instance.Name, instance.Address, model, freq, "3")
+		counters.add(p.USChannelTimeouts, "us_channel_timeouts_total", channel.T4Timeouts, instance.Name, instance.Address, model, freq, "4")
+		ch <- prometheus.MustNewConstMetric(p.USChannelInfo, prometheus.GaugeValue, float64(1), instance.Name, instance.Address, model, freq, channel.Modulation, channel.SymbolRate, channel.ChannelType)
+	}
 
+	// 3.1 DS Channels
+	for _, channel := range status.DS31Channels {
+		id := strconv.FormatInt(channel.ID, 10)
+		// The frequency labels are left empty when the driver can't read
+		// the first subcarrier
+		start, end := "", ""
+		if startFreq, endFreq := channel.FrequencyRange(); startFreq > 0 {
+			start = strconv.FormatInt(startFreq, 10)
+			end = strconv.FormatInt(endFreq, 10)
+		}
+		ch <- prometheus.MustNewConstMetric(p.DS31ChannelLocked, prometheus.GaugeValue, boolToFloat(channel.Locked), instance.Name, instance.Address, model, id, start, end)
+		ch <- prometheus.MustNewConstMetric(p.DS31ChannelPLCPower, prometheus.GaugeValue, channel.PLCPower, instance.Name, instance.Address, model, id, start, end)
+		ch <- prometheus.MustNewConstMetric(p.DS31ChannelRXMer, prometheus.GaugeValue, channel.RxMER, instance.Name, instance.Address, model, id, start, end)
+		counters.add(p.DS31ChannelPreRS, "ds31_channel_prers_errors_total", channel.PreRSErrors, instance.Name, instance.Address, model, id, start, end)
+		counters.add(p.DS31ChannelPostRS, "ds31_channel_postrs_errors_total", channel.PostRSErrors, instance.Name, instance.Address, model, id, start, end)
+		ch <- prometheus.MustNewConstMetric(p.DS31ChannelSubcarriers, prometheus.GaugeValue, float64(channel.Subcarriers), instance.Name, instance.Address, model, id, start, end)
+		// Not every driver can read the first subcarrier or the width
+		if channel.FirstSubcarrier > 0 {
+			ch <- prometheus.MustNewConstMetric(p.DS31ChannelFirstSubcarrier, prometheus.GaugeValue, float64(channel.FirstSubcarrier), instance.Name, instance.Address, model, id, start, end)
+		}
+		if channel.ChannelWidth > 0 {
+			ch <- prometheus.MustNewConstMetric(p.DS31ChannelWidth, prometheus.GaugeValue, channel.ChannelWidth, instance.Name, instance.Address, model, id, start, end)
+		}
+		ch <- prometheus.MustNewConstMetric(p.DS31ChannelInfo, prometheus.GaugeValue, float64(1), instance.Name, instance.Address, model, id, start, end, channel.FFTType, channel.Modulation)
+	}
 
-			// 5 - Network Access
-			value = gjson.Get(string(body), "5")
-			if value.String() == "true" {
-				ch <- prometheus.MustNewConstMetric(p.networkAccess, prometheus.GaugeValue, float64(1), instance.Name, instance.Address)
-			} else {
-				ch <- prometheus.MustNewConstMetric(p.networkAccess, prometheus.GaugeValue, float64(0), instance.Name, instance.Address)
-			}
+	// 3.1 US Channels
+	for _, channel := range status.US31Channels {
+		freq := strconv.FormatInt(channel.Frequency, 10)
+		ch <- prometheus.MustNewConstMetric(p.US31ChannelPower, prometheus.GaugeValue, channel.Power, instance.Name, instance.Address, model, freq)
+		counters.add(p.US31ChannelTimeouts, "us31_channel_timeouts_total", channel.T1Timeouts, instance.Name, instance.Address, model, freq, "1")
+		counters.add(p.US31ChannelTimeouts, "us31_channel_timeouts_total", channel.T2Timeouts, instance.Name, instance.Address, model, freq, "2")
+		counters.add(p.US31ChannelTimeouts, "us31_channel_timeouts_total", channel.T3Timeouts, instance.Name, instance.Address, model, freq, "3")
+		counters.add(p.US31ChannelTimeouts, "us31_channel_timeouts_total", channel.T4Timeouts, instance.Name, instance.Address, model, freq, "4")
+		ch <- prometheus.MustNewConstMetric(p.US31ChannelInfo, prometheus.GaugeValue, float64(1), instance.Name, instance.Address, model, freq, channel.Modulation, channel.ChannelType, channel.FFTType)
+	}
 
+	// Channel counts
+	ch <- prometheus.MustNewConstMetric(p.USNumber, prometheus.GaugeValue, status.Counts.US, instance.Name, instance.Address, model)
+	ch <- prometheus.MustNewConstMetric(p.DSNumber, prometheus.GaugeValue, status.Counts.DS, instance.Name, instance.Address, model)
+	ch <- prometheus.MustNewConstMetric(p.USNumber31, prometheus.GaugeValue, status.Counts.US31, instance.Name, instance.Address, model)
+	ch <- prometheus.MustNewConstMetric(p.DSNumber31, prometheus.GaugeValue, status.Counts.DS31, instance.Name, instance.Address, model)
 
-			// 6 - Max CPE Allowed
-			value = gjson.Get(string(body), "6")
-			ch <- prometheus.MustNewConstMetric(p.maxCPE, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
+	// Pages needing a login
+	p.collectAdmin(instanceCtx, ch, instance, httpClient, probe)
 
-			// 7 - BPI State
-			value = gjson.Get(string(body), "7")
-			if value.String() == "true" {
-				ch <- prometheus.MustNewConstMetric(p.BPIState, prometheus.GaugeValue, float64(1), instance.Name, instance.Address)
-			} else {
-				ch <- prometheus.MustNewConstMetric(p.BPIState, prometheus.GaugeValue, float64(0), instance.Name, instance.Address)
-			}
+	// Count counters that went backwards since the last scrape
+	if !probe {
+		for metric, resets := range p.counters.update(instance.Key, counters.values) {
+			p.counterResets.WithLabelValues(instance.Name, instance.Address, model, metric).Add(float64(resets))
+		}
+	}
+	return true
+}
 
-			// 8 - Docsis Version
-			value = gjson.Get(string(body), "8")
-			ch <- prometheus.MustNewConstMetric(p.DOCSISVersion, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
-
-			// 9 - Boot File
-			//value = gjson.Get(string(body), "9")
-			//fmt.Printf("Config File: %s\n", value)
-
-			// 10 - DS Flow ID
-			value = gjson.Get(string(body), "10")
-			ch <- prometheus.MustNewConstMetric(p.DSFlowID, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
-
-			// 11 - DS Traffic Rate (Max)
-			value = gjson.Get(string(body), "11")
-			ch <- prometheus.MustNewConstMetric(p.DSTrafficRate, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
-
-			// 12 - DS Traffic Rate (Max burst)
-			value = gjson.Get(string(body), "12")
-			ch <- prometheus.MustNewConstMetric(p.DSTrafficRateBurst, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
-
-			// 13 - DS Min Traffic Rate
-			value = gjson.Get(string(body), "13")
-			ch <- prometheus.MustNewConstMetric(p.DSTrafficRateMin, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
-
-			// 14 - US Flow ID
-			value = gjson.Get(string(body), "14")
-			ch <- prometheus.MustNewConstMetric(p.USFlowID, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
-
-			// 15 - US Traffic Rate (Max)
-			value = gjson.Get(string(body), "15")
-			ch <- prometheus.MustNewConstMetric(p.USTrafficRate, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
-
-			// 16 - US Trafic Rate (Max burst)
-			value = gjson.Get(string(body), "16")
-			ch <- prometheus.MustNewConstMetric(p.USTrafficRateBurst, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
-
-			// 17 - US Min Trafic Rate
-			value = gjson.Get(string(body), "17")
-			ch <- prometheus.MustNewConstMetric(p.USTrafficRateMin, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
-
-			// 18 - US Max Conn Burst
-			value = gjson.Get(string(body), "18")
-			ch <- prometheus.MustNewConstMetric(p.USTrafficConnBurst, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
-
-			// 19 - Scheduling Type
-			//value = gjson.Get(string(body), "19")
-			//fmt.Printf("Scheduling Type: %s\n", value)
-
-			// 20 - DS Channel - JSON
-			dsChannels := gjson.Parse(gjson.Get(string(body), "20").String())
-			dsChannels.ForEach(func(key, value gjson.Result) bool {
-				channel := gjson.Parse(value.String())
-				//id := channel.Get("0").Int()
-				freq := channel.Get("1").String()
-				ch <- prometheus.MustNewConstMetric(p.DSChannelPower, prometheus.GaugeValue, channel.Get("2").Float(), instance.Name, instance.Address, freq)
-				ch <- prometheus.MustNewConstMetric(p.DSChannelSNR, prometheus.GaugeValue, channel.Get("3").Float(), instance.Name, instance.Address, freq)
-				//modulation := channel.Get("4").String()
-				status := channel.Get("5").String()
-				if status == "Locked" {
-					ch <- prometheus.MustNewConstMetric(p.DSChannelLocked, prometheus.GaugeValue, float64(1), instance.Name, instance.Address, freq)
-				} else {
-					ch <- prometheus.MustNewConstMetric(p.DSChannelLocked, prometheus.GaugeValue, float64(0), instance.Name, instance.Address, freq)
-				}
+// scrapeFailed records a failed scrape of an instance
+func (p *Exporter) scrapeFailed(ch chan<- prometheus.Metric, instance *config.InstancesConfig, reason string, err error, probe bool) {
+	model := p.model(instance)
+	if probe {
+		log.Errorf("Probe of %s failed: %s", instance.Address, err)
+	} else {
+		log.Errorf("Scrape of instance %s failed: %s", instance.Name, err)
+		p.scrapeErrors.WithLabelValues(instance.Name, instance.Address, model, reason).Inc()
+	}
+	ch <- prometheus.MustNewConstMetric(p.up, prometheus.GaugeValue, float64(0), instance.Name, instance.Address, model)
+}
 
-				ch <- prometheus.MustNewConstMetric(p.DSChannelRXMer, prometheus.GaugeValue, channel.Get("6").Float(), instance.Name, instance.Address, freq)
-				ch <- prometheus.MustNewConstMetric(p.DSChannelPreRS, prometheus.GaugeValue, channel.Get("7").Float(), instance.Name, instance.Address, freq)
-				ch <- prometheus.MustNewConstMetric(p.DSChannelPostRS, prometheus.GaugeValue, channel.Get("8").Float(), instance.Name, instance.Address, freq)
-
-				//prerserrors := channel.Get("7").Int()
-				//postrserrors := channel.Get("8").Int()
-				////fmt.Printf("Docsis 3.0 DS Channel: %d @ %dHz, %f dBmV, SNR %f dB, Modulation %s, Status %s, RXMer %f dB, PreRS %d, Post RS %d\n",
-				//	id,freq,power,snr,modulation,status,rxmer,prerserrors,postrserrors)
-				return true
-			})
-
-			// 21 - US Channel - JSON
-			usChannels := gjson.Parse(gjson.Get(string(body), "21").String())
-			usChannels.ForEach(func(key, value gjson.Result) bool {
-				channel := gjson.Parse(value.String())
-				id := channel.Get("0").Int()
-				if id != 0 {
-					// 	USChannelPower *prometheus.Desc
-					//	USChannelSymbolRate* prometheus.Desc
-					//	USChannelTimeouts *prometheus.Desc
-
-					freq := channel.Get("1").String()
-					ch <- prometheus.MustNewConstMetric(p.USChannelPower, prometheus.GaugeValue, channel.Get("2").Float(), instance.Name, instance.Address, freq)
-					//power := channel.Get("2").Float()
-					//symbolrate := channel.Get("3").String()
-					//modulation := channel.Get("4").String()
-					//channeltype := channel.Get("5").String()
-					ch <- prometheus.MustNewConstMetric(p.USChannelTimeouts, prometheus.GaugeValue, channel.Get("6").Float(), instance.Name, instance.Address, freq, "1")
-					ch <- prometheus.MustNewConstMetric(p.USChannelTimeouts, prometheus.GaugeValue, channel.Get("7").Float(), instance.Name, instance.Address, freq, "2")
-					ch <- prometheus.MustNewConstMetric(p.USChannelTimeouts, prometheus.GaugeValue, channel.Get("8").Float(), instance.Name, instance.Address, freq, "3")
-					ch <- prometheus.MustNewConstMetric(p.USChannelTimeouts, prometheus.GaugeValue, channel.Get("9").Float(), instance.Name, instance.Address, freq, "4")
-					//t1timeouts := channel.Get("6").Float()
-					//t2timeouts := channel.Get("7").Float()
-					//t3timeouts := channel.Get("8").Float()
-					//t4timeouts := channel.Get("9").Float()
-					////fmt.Printf("Docsis 3.0 US Channel: %d @ %d Hz, Power %f dBmV, Symbol Rate %s, Modulation %s, Channel Type %s, Timeouts T1:%d T2:%d T3:%d T4:%d\n",
-					//	id, frequency, power, symbolrate, modulation, channeltype, t1timeouts, t2timeouts, t3timeouts, t4timeouts)
-				}
-				return true
-			})
-			// 22 - Network Data - JSON
-			// 23 - 3.1 DS Channel - JSON
-			dsChannels31 := gjson.Parse(gjson.Get(string(body), "23").String())
-			dsChannels31.ForEach(func(key, value gjson.Result) bool {
-				channel := gjson.Parse(value.String())
-				id := channel.Get("0").String()
-				//channelwidth := channel.Get("1").Int()
-				//fft := channel.Get("2").String()
-				//subcarriers := channel.Get("3").Int()
-				//modulation := channel.Get("4").String()
-				//firstsubcarrier := channel.Get("5").Int()
-				//lockstatus := channel.Get("6").String()
-				//rxmer := channel.Get("7").Float()
-				//plcpower := channel.Get("8").Float()
-				////prerserrors := channel.Get("9").Int()
-				////postrserrors := channel.Get("10").Int()
-
-				//freq := channel.Get("1").String()
-
-
-				status := channel.Get("6").String()
-				if status == "Locked" {
-					ch <- prometheus.MustNewConstMetric(p.DS31ChannelLocked, prometheus.GaugeValue, float64(1), instance.Name, instance.Address, id)
-				} else {
-					ch <- prometheus.MustNewConstMetric(p.DS31ChannelLocked, prometheus.GaugeValue, float64(0), instance.Name, instance.Address, id)
-				}
-				ch <- prometheus.MustNewConstMetric(p.DS31ChannelPLCPower, prometheus.GaugeValue, channel.Get("8").Float(), instance.Name, instance.Address, id)
-				ch <- prometheus.MustNewConstMetric(p.DS31ChannelRXMer, prometheus.GaugeValue, channel.Get("6").Float(), instance.Name, instance.Address, id)
-				ch <- prometheus.MustNewConstMetric(p.DS31ChannelPreRS, prometheus.GaugeValue, channel.Get("9").Float(), instance.Name, instance.Address, id)
-				ch <- prometheus.MustNewConstMetric(p.DS31ChannelPostRS, prometheus.GaugeValue, channel.Get("10").Float(), instance.Name, instance.Address, id)
-				ch <- prometheus.MustNewConstMetric(p.DS31ChannelFirstSubcarrier, prometheus.GaugeValue, channel.Get("5").Float(), instance.Name, instance.Address, id)
-				ch <- prometheus.MustNewConstMetric(p.DS31ChannelSubcarriers, prometheus.GaugeValue, channel.Get("3").Float(), instance.Name, instance.Address, id)
-				ch <- prometheus.MustNewConstMetric(p.DS31ChannelWidth, prometheus.GaugeValue, channel.Get("1").Float(), instance.Name, instance.Address, id)
-				//fmt.Printf("Docsis 3.1 DS Channel: %d @ %d MHz Wide, FFT %s, Subcarriers %d, Modulation: %s, " +
-				//	"First Subcarrier %d Hz, Lock Status %s, RXMer %f dB, PLC Power %f dBmV, Pre RS %d, Post RS %d\n",
-				//	id, channelwidth, fft, subcarriers, modulation, firstsubcarrier, lockstatus, rxmer, plcpower, prerserrors, postrserrors)
-				return true
-			})
-			// 24 - 3.1 US Channel - JSON
-			//usChannels31 := gjson.Parse(gjson.Get(string(body), "24").String())
-			//usChannels31.ForEach(func(key, value gjson.Result) bool {
-			//	channel := gjson.Parse(value.String())
-			//	id := channel.Get("0").Int()
-			//	if id != 0 {
-			//		frequency := channel.Get("1").Int()
-			//
-			//		power := channel.Get("2").Float()
-			//		symbolrate := channel.Get("3").String()
-			//		modulation := channel.Get("4").String()
-			//		channeltype := channel.Get("5").String()
-			//		t1timeouts := channel.Get("6").Int()
-			//		t2timeouts := channel.Get("7").Int()
-			//		t3timeouts := channel.Get("8").Int()
-			//		t4timeouts := channel.Get("9").Int()
-			//		fmt.Printf("Docsis 3.1 US Channel: %d @ %d Hz, Power %f dBmV, Symbol Rate %s, Modulation %s, Channel Type %s, Timeouts T1:%d T2:%d T3:%d T4:%d\n",
-			//			id, frequency, power, symbolrate, modulation, channeltype, t1timeouts, t2timeouts, t3timeouts, t4timeouts)
-			//	}
-			//	return true
-			//})
-			// 25 - US Number
-			value = gjson.Get(string(body), "25")
-			ch <- prometheus.MustNewConstMetric(p.USNumber, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
-
-			// 26 - DS Number
-			value = gjson.Get(string(body), "26")
-			ch <- prometheus.MustNewConstMetric(p.DSNumber, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
-
-			// 27 - 3.1 US Number
-			value = gjson.Get(string(body), "27")
-			ch <- prometheus.MustNewConstMetric(p.USNumber31, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
-			// 28 - 3.1 DS Number
-			value = gjson.Get(string(body), "28")
-			ch <- prometheus.MustNewConstMetric(p.DSNumber31, prometheus.GaugeValue, value.Float(), instance.Name, instance.Address)
-
-
-			// 29 - Primary Channel type
-			//value = gjson.Get(string(body), "29")
-			//fmt.Printf("Primary Channel Type: %s\n", value)
-
-			instanceWG.Done()
-		}(instance)
+// States reported by the Hub 4 for the acquired downstream and ranged
+// upstream channels, any other state seen is reported as well
+var (
+	aquiredDSChannelStates = []string{"Locked", "Not Locked"}
+	rangedUSChannelStates  = []string{"Success", "In Progress", "Failed"}
+)
+
+// collectStateSet reports each of the known states, with the current state
+// set to 1 and the rest 0
+func (p *Exporter) collectStateSet(ch chan<- prometheus.Metric, desc *prometheus.Desc, states []string, current string, instance *config.InstancesConfig) {
+	model := p.model(instance)
+	known := false
+	for _, state := range states {
+		value := float64(0)
+		if state == current {
+			value = 1
+			known = true
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, instance.Name, instance.Address, model, state)
 	}
-	// Wait for all instances to complete their poll
-	instanceWG.Wait()
-}
\ No newline at end of file
+	if !known {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(1), instance.Name, instance.Address, model, current)
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,436 @@
+package collectors
+
+import (
+	"bytes"
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"hub4_exporter/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newHub4Server serves a Hub 4 network status response from testdata
+func newHub4Server(t *testing.T, data []byte) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/php/ajaxGet_device_networkstatus_data.php" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// readTestdata reads a recorded response, which the drivers' tests share
+func readTestdata(t *testing.T, file string) []byte {
+	data, err := ioutil.ReadFile("../drivers/testdata/" + file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// gauges returns the value of each series of a metric by address
+func gauges(t *testing.T, families []*dto.MetricFamily, name string) map[string]float64 {
+	values := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				if label.GetName() == "address" {
+					values[label.GetValue()] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return values
+}
+
+func TestCollectUnnamedInstances(t *testing.T) {
+	data := readTestdata(t, "hub4_networkstatus.json")
+	first := newHub4Server(t, data)
+	second := newHub4Server(t, bytes.Replace(data, []byte(`"330000000"`), []byte(`"338000000"`), 1))
+
+	conf, err := config.ConfigParse(strings.NewReader(`
+instances:
+  - address: ` + strings.TrimPrefix(first.URL, "http://") + `
+    type: hub4
+  - address: ` + strings.TrimPrefix(second.URL, "http://") + `
+    type: hub4
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(PromExporter(5*time.Second, conf))
+
+	// Both scrapes must gather without duplicate series
+	for i := 0; i < 2; i++ {
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		up := gauges(t, families, "hub4_up")
+		acquired := gauges(t, families, "hub4_aquired_DS_channel")
+		for _, server := range []*httptest.Server{first, second} {
+			address := strings.TrimPrefix(server.URL, "http://")
+			if up[address] != 1 {
+				t.Errorf("got hub4_up %v for %s, want 1", up[address], address)
+			}
+		}
+		if got := acquired[strings.TrimPrefix(first.URL, "http://")]; got != 330000000 {
+			t.Errorf("got acquired DS channel %v from the first instance, want 330000000", got)
+		}
+		if got := acquired[strings.TrimPrefix(second.URL, "http://")]; got != 338000000 {
+			t.Errorf("got acquired DS channel %v from the second instance, want 338000000", got)
+		}
+
+		// Each instance's request timings are kept apart
+		for _, family := range families {
+			if family.GetName() != "hub4_http_phase_seconds" {
+				continue
+			}
+			addresses := map[string]bool{}
+			for _, metric := range family.Metric {
+				for _, label := range metric.Label {
+					if label.GetName() == "address" {
+						addresses[label.GetValue()] = true
+					}
+				}
+			}
+			if len(addresses) != 2 {
+				t.Errorf("got hub4_http_phase_seconds for %d addresses, want 2", len(addresses))
+			}
+		}
+	}
+}
+
+func TestCollectMalformedResponse(t *testing.T) {
+	for _, data := range []string{`not json`, `["330000000","49600000"]`, `{}`} {
+		server := newHub4Server(t, []byte(data))
+		conf, err := config.ConfigParse(strings.NewReader(`
+instances:
+  - name: hub
+    address: ` + strings.TrimPrefix(server.URL, "http://") + `
+    type: hub4
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := PromExporter(5*time.Second, conf)
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(p)
+
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if up := gauges(t, families, "hub4_up"); len(up) != 1 || up[conf.Instances[0].Address] != 0 {
+			t.Errorf("%q: got hub4_up %v, want 0", data, up)
+		}
+		if n := testutil.ToFloat64(p.scrapeErrors.WithLabelValues("hub", conf.Instances[0].Address, "hub4", "parse_error")); n != 1 {
+			t.Errorf("%q: got %v parse errors, want 1", data, n)
+		}
+	}
+}
+
+// newHub4AdminServer serves a Hub 4's network status and admin pages, the
+// admin pages need the session cookie set by logging in. Like the Hub 4,
+// pages it doesn't have redirect to the home page. Requests are counted by
+// path.
+func newHub4AdminServer(t *testing.T, pages map[string][]byte) (*httptest.Server, map[string]int) {
+	var mutex sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.URL.Path]++
+		mutex.Unlock()
+		if r.URL.Path == "/php/ajaxSet_Password.php" {
+			http.SetCookie(w, &http.Cookie{Name: "credential", Value: "session", Path: "/"})
+			w.Write([]byte(`{"p_status":"Match"}`))
+			return
+		}
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			if r.URL.Path != "/home.php" {
+				http.Redirect(w, r, "/home.php", http.StatusFound)
+				return
+			}
+			w.Write([]byte("<html></html>"))
+			return
+		}
+		if _, err := r.Cookie("credential"); err != nil && !strings.Contains(r.URL.Path, "networkstatus") {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		w.Write(page)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestCollectClientInfoDuplicates(t *testing.T) {
+	server, _ := newHub4AdminServer(t, map[string][]byte{
+		"/php/ajaxGet_device_networkstatus_data.php": readTestdata(t, "hub4_networkstatus.json"),
+		// The laptop is connected on both Wi-Fi bands
+		"/php/ajaxGet_device_connected_clients_data.php": []byte(`[
+			["laptop","AA:BB:CC:00:00:01","192.168.0.10","Wi-Fi","2.4 GHz"],
+			["laptop","aa:bb:cc:00:00:01","192.168.0.10","Wi-Fi","5 GHz"],
+			["nas","AA:BB:CC:00:00:03","192.168.0.12","Ethernet"]
+		]`),
+	})
+
+	conf, err := config.ConfigParse(strings.NewReader(`
+instances:
+  - address: ` + strings.TrimPrefix(server.URL, "http://") + `
+    type: hub4
+    credentials:
+      password: secret
+    clients:
+      info: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(PromExporter(5*time.Second, conf))
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "hub4_client_info" && len(family.Metric) != 2 {
+			t.Errorf("got %d hub4_client_info series, want 2", len(family.Metric))
+		}
+	}
+	if clients := gauges(t, families, "hub4_client_info"); len(clients) == 0 {
+		t.Error("no hub4_client_info series")
+	}
+
+	// The laptop is counted once, like it's reported once
+	total := float64(0)
+	for _, family := range families {
+		if family.GetName() == "hub4_connected_clients" {
+			for _, metric := range family.Metric {
+				total += metric.GetGauge().GetValue()
+			}
+		}
+	}
+	if total != 2 {
+		t.Errorf("got %v hub4_connected_clients, want 2", total)
+	}
+}
+
+func TestCollectWifi(t *testing.T) {
+	server, requests := newHub4AdminServer(t, map[string][]byte{
+		"/php/ajaxGet_device_networkstatus_data.php": readTestdata(t, "hub4_networkstatus.json"),
+		// Two radios on the 5 GHz band, and no Wi-Fi scan page
+		"/php/ajaxGet_device_wifi_status_data.php": []byte(`[
+			["2.4GHz","true","6","20MHz","802.11ax","3"],
+			["5GHz","true","36","80MHz","802.11ax","2"],
+			["5GHz","true","100","80MHz","802.11ax","1"]
+		]`),
+	})
+
+	conf, err := config.ConfigParse(strings.NewReader(`
+instances:
+  - address: ` + strings.TrimPrefix(server.URL, "http://") + `
+    type: hub4
+    credentials:
+      password: secret
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(PromExporter(5*time.Second, conf))
+
+	for i := 0; i < 3; i++ {
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, family := range families {
+			if family.GetName() == "hub4_wifi_radio_clients" && len(family.Metric) != 3 {
+				t.Errorf("got %d hub4_wifi_radio_clients series, want 3", len(family.Metric))
+			}
+		}
+	}
+
+	// The missing scan page is only asked for once, without logging in again
+	if n := requests["/php/ajaxGet_device_wifi_scan_data.php"]; n != 1 {
+		t.Errorf("asked for the Wi-Fi scan %d times, want 1", n)
+	}
+	if n := requests["/php/ajaxSet_Password.php"]; n != 1 {
+		t.Errorf("logged in %d times, want 1", n)
+	}
+}
+
+// scrapeExporter collects the exporter's metrics on ctx
+func scrapeExporter(p *Exporter, ctx context.Context) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		p.collect(ctx, ch)
+		close(ch)
+	}()
+	var metrics []prometheus.Metric
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// waitFetches waits for the fetches scrapes gave up on to finish
+func waitFetches(t *testing.T, p *Exporter) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		p.fetches.mutex.Lock()
+		n := len(p.fetches.inflight)
+		p.fetches.mutex.Unlock()
+		if n == 0 {
+			return
+		}
+	}
+	t.Fatal("fetches still running")
+}
+
+func TestCollectCancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	conf, err := config.ConfigParse(strings.NewReader(`
+instances:
+  - name: hub
+    address: ` + strings.TrimPrefix(server.URL, "http://") + `
+    type: hub4
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := PromExporter(5*time.Second, conf)
+	timeouts := p.scrapeErrors.WithLabelValues("hub", conf.Instances[0].Address, "hub4", "timeout")
+	scrape := func(ctx context.Context) {
+		for range scrapeExporter(p, ctx) {
+		}
+	}
+
+	// A client going away isn't a timeout of the modem
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	scrape(ctx)
+	if n := testutil.ToFloat64(timeouts); n != 0 {
+		t.Errorf("got %v timeouts after a cancelled scrape, want 0", n)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	scrape(ctx)
+	waitFetches(t, p)
+	if n := testutil.ToFloat64(timeouts); n != 1 {
+		t.Errorf("got %v timeouts after a scrape timed out, want 1", n)
+	}
+}
+
+func TestCollectConcurrentTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	conf, err := config.ConfigParse(strings.NewReader(`
+instances:
+  - name: hub
+    address: ` + strings.TrimPrefix(server.URL, "http://") + `
+    type: hub4
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := PromExporter(5*time.Second, conf)
+	timeouts := p.scrapeErrors.WithLabelValues("hub", conf.Instances[0].Address, "hub4", "timeout")
+
+	// Two scrapes with different timeouts share one fetch, which times out
+	// with the earlier
+	var wg sync.WaitGroup
+	for _, timeout := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond} {
+		wg.Add(1)
+		go func(timeout time.Duration) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			up := 0
+			for _, metric := range scrapeExporter(p, ctx) {
+				if metric.Desc() == p.up {
+					up++
+				}
+			}
+			if up != 1 {
+				t.Errorf("got %d hub4_up from a scrape timing out after %s, want 1", up, timeout)
+			}
+		}(timeout)
+	}
+	wg.Wait()
+	waitFetches(t, p)
+	if n := testutil.ToFloat64(timeouts); n != 1 {
+		t.Errorf("got %v timeouts after two scrapes timed out, want 1", n)
+	}
+}
+
+func TestCollectDS31WithoutFirstSubcarrier(t *testing.T) {
+	page := readTestdata(t, "sb8200_cmconnectionstatus.html")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(page)
+	}))
+	t.Cleanup(server.Close)
+
+	conf, err := config.ConfigParse(strings.NewReader(`
+instances:
+  - name: sb8200
+    address: ` + strings.TrimPrefix(server.URL, "http://") + `
+    type: html
+    html:
+      model: sb8200
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(PromExporter(5*time.Second, conf))
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The OFDM channel's first subcarrier isn't on the page
+	for _, family := range families {
+		switch family.GetName() {
+		case "hub4_ds31_channel_first_subcarrier":
+			t.Errorf("got %d hub4_ds31_channel_first_subcarrier series, want none", len(family.Metric))
+		case "hub4_ds31_channel_locked":
+			if len(family.Metric) != 1 {
+				t.Fatalf("got %d hub4_ds31_channel_locked series, want 1", len(family.Metric))
+			}
+			for _, label := range family.Metric[0].Label {
+				if (label.GetName() == "start_frequency" || label.GetName() == "end_frequency") && label.GetValue() != "" {
+					t.Errorf("got %s %q, want it empty", label.GetName(), label.GetValue())
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package collectors
+
+import (
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"hub4_exporter/config"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Defaults for instances without http settings
+const (
+	defaultIdleTimeout     = time.Second * 90
+	defaultMaxResponseSize = 10 << 20
+)
+
+var errResponseTooLarge = errors.New("response too large")
+
+// httpClients holds a long lived client for each instance, so connections
+// to the modem are kept open between scrapes
+type httpClients struct {
+	mutex   sync.Mutex
+	clients map[string]*http.Client
+}
+
+func newHTTPClients() *httpClients {
+	return &httpClients{
+		clients: map[string]*http.Client{},
+	}
+}
+
+// httpClient returns the instance's client, creating it on first use
+func (p *Exporter) httpClient(instance *config.InstancesConfig) (*http.Client, error) {
+	p.clients.mutex.Lock()
+	defer p.clients.mutex.Unlock()
+
+	if client, ok := p.clients.clients[instance.Key]; ok {
+		return client, nil
+	}
+	client, err := p.newHTTPClient(instance, p.httpPhases)
+	if err != nil {
+		return nil, err
+	}
+	p.clients.clients[instance.Key] = client
+	return client, nil
+}
+
+func newHTTPPhases() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "phase_seconds",
+			Help:      "Time taken to connect, to the first byte of the response and in total by requests to the instance",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"instance", "address", "phase"},
+	)
+}
+
+// newHTTPClient builds a client from the instance's http settings, timing
+// each request into phases
+func (p *Exporter) newHTTPClient(instance *config.InstancesConfig, phases *prometheus.HistogramVec) (*http.Client, error) {
+	conf := instance.HTTP
+	if conf == nil {
+		conf = &config.HTTPConfig{}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   p.instanceTimeout(instance),
+		KeepAlive: time.Second * 30,
+	}
+	if conf.SourceInterface != "" {
+		ip, err := interfaceAddress(conf.SourceInterface)
+		if err != nil {
+			return nil, err
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	idleTimeout := conf.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = defaultIdleTimeout
+	}
+	maxResponseSize := conf.MaxResponseSize
+	if maxResponseSize == 0 {
+		maxResponseSize = defaultMaxResponseSize
+	}
+
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		DisableKeepAlives:   conf.DisableKeepAlives,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     idleTimeout,
+		TLSHandshakeTimeout: time.Second * 10,
+	}
+	return &http.Client{
+		Transport: &tracingTransport{
+			next:            transport,
+			maxResponseSize: maxResponseSize,
+			phases:          phases.MustCurryWith(prometheus.Labels{"instance": instance.Name, "address": instance.Address}),
+		},
+	}, nil
+}
+
+// interfaceAddress returns the first address of an interface, preferring
+// IPv4
+func interfaceAddress(name string) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("source interface %s: %s", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("source interface %s: %s", name, err)
+	}
+	var found net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		}
+		if found == nil {
+			found = ipNet.IP
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("source interface %s has no address", name)
+	}
+	return found, nil
+}
+
+// tracingTransport times the phases of each request and limits the size of
+// the response body
+type tracingTransport struct {
+	next            http.RoundTripper
+	maxResponseSize int64
+	phases          prometheus.ObserverVec
+}
+
+func (t *tracingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	start := time.Now()
+	var connectStart time.Time
+	trace := &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) {
+			connectStart = time.Now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				t.phases.WithLabelValues("connect").Observe(time.Since(connectStart).Seconds())
+			}
+		},
+		GotFirstResponseByte: func() {
+			t.phases.WithLabelValues("ttfb").Observe(time.Since(start).Seconds())
+		},
+	}
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+
+	response, err := t.next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	response.Body = &limitedBody{
+		body:      response.Body,
+		remaining: t.maxResponseSize,
+		done: func() {
+			t.phases.WithLabelValues("total").Observe(time.Since(start).Seconds())
+		},
+	}
+	return response, nil
+}
+
+// limitedBody fails reads past the size limit, and records the total time
+// of the request once the body is closed
+type limitedBody struct {
+	body      io.ReadCloser
+	remaining int64
+	done      func()
+	closed    bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Only fail if there's more to read
+		var one [1]byte
+		if n, _ := b.body.Read(one[:]); n > 0 {
+			return 0, errResponseTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	if !b.closed {
+		b.closed = true
+		b.done()
+	}
+	return b.body.Close()
+}
@@ -0,0 +1,90 @@
+package collectors
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"hub4_exporter/config"
+	"hub4_exporter/drivers"
+	"net/http"
+	"sync"
+)
+
+// hub4Sessions holds the admin web UI session of each Hub 4 instance with
+// credentials, so it logs in once rather than on every scrape
+type hub4Sessions struct {
+	mutex    sync.Mutex
+	sessions map[string]*drivers.Hub4Session
+}
+
+func newHub4Sessions() *hub4Sessions {
+	return &hub4Sessions{
+		sessions: map[string]*drivers.Hub4Session{},
+	}
+}
+
+// hub4Session returns the instance's session, creating it on first use.
+// Probes get a new session each time.
+func (p *Exporter) hub4Session(instance *config.InstancesConfig, httpClient *http.Client, probe bool) (*drivers.Hub4Session, error) {
+	if probe {
+		return drivers.NewHub4Session(httpClient, instance)
+	}
+
+	p.sessions.mutex.Lock()
+	defer p.sessions.mutex.Unlock()
+
+	if session, ok := p.sessions.sessions[instance.Key]; ok {
+		return session, nil
+	}
+	session, err := drivers.NewHub4Session(httpClient, instance)
+	if err != nil {
+		return nil, err
+	}
+	p.sessions.sessions[instance.Key] = session
+	return session, nil
+}
+
+// collectAdmin collects from the admin web UI of Hub 4 instances with
+// credentials. Failures are logged but don't fail the scrape, as the network
+// status doesn't need a login.
+func (p *Exporter) collectAdmin(ctx context.Context, ch chan<- prometheus.Metric, instance *config.InstancesConfig, httpClient *http.Client, probe bool) {
+	if instance.Type != "hub4" || instance.Credentials == nil {
+		return
+	}
+	session, err := p.hub4Session(instance, httpClient, probe)
+	if err != nil {
+		log.Errorf("Unable to log in to instance %s: %s", instance.Name, err)
+		return
+	}
+	if err := session.Login(ctx); err != nil {
+		p.adminFailed(instance, err, probe)
+		return
+	}
+
+	if err := p.collectSystemInfo(ctx, ch, instance, session, probe); err != nil {
+		p.adminFailed(instance, err, probe)
+	}
+	if err := p.collectClients(ctx, ch, instance, session); err != nil {
+		p.adminFailed(instance, err, probe)
+	}
+	if err := p.collectWifi(ctx, ch, instance, session, probe); err != nil {
+		p.adminFailed(instance, err, probe)
+	}
+
+	// The event log is only counted across scrapes, so not for probes
+	if !probe {
+		if err := p.collectEvents(ctx, instance, session); err != nil {
+			p.adminFailed(instance, err, probe)
+		}
+	}
+}
+
+// adminFailed logs a failure to read an admin page, counting failed logins
+func (p *Exporter) adminFailed(instance *config.InstancesConfig, err error, probe bool) {
+	log.Errorf("Unable to read the admin pages of instance %s: %s", instance.Name, err)
+	var loginErr *drivers.LoginError
+	if !probe && errors.As(err, &loginErr) {
+		p.loginFailures.WithLabelValues(instance.Name, instance.Address, p.model(instance)).Inc()
+	}
+}
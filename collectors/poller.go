@@ -0,0 +1,106 @@
+package collectors
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"hub4_exporter/config"
+	"sync"
+	"time"
+)
+
+// snapshot holds the metrics from the last poll of an instance, served to
+// scrapes in place of fetching from the modem
+type snapshot struct {
+	mutex sync.Mutex
+	// Set once the first poll has finished
+	polled bool
+	// Whether the last poll was successful, and the model it found
+	up    bool
+	model string
+	// Metrics from the last poll if it was successful, without up
+	metrics     []prometheus.Metric
+	lastSuccess time.Time
+}
+
+// pollInterval returns the instance's poll interval, 0 if it's scraped live
+func (p *Exporter) pollInterval(instance *config.InstancesConfig) time.Duration {
+	if instance.PollInterval > 0 {
+		return instance.PollInterval
+	}
+	return p.config.PollInterval
+}
+
+// StartPolling polls each instance with a poll interval in the background
+// until ctx is cancelled
+func (p *Exporter) StartPolling(ctx context.Context) {
+	for _, instance := range p.config.Instances {
+		snapshot, ok := p.snapshots[instance.Key]
+		if !ok {
+			continue
+		}
+		go p.poll(ctx, instance, snapshot)
+	}
+}
+
+func (p *Exporter) poll(ctx context.Context, instance *config.InstancesConfig, snapshot *snapshot) {
+	interval := p.pollInterval(instance)
+	log.Infof("Polling instance %s every %s", instance.Name, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.pollOnce(ctx, instance, snapshot)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollOnce collects from an instance into its snapshot
+func (p *Exporter) pollOnce(ctx context.Context, instance *config.InstancesConfig, snapshot *snapshot) {
+	gathered, up := p.gatherInstance(ctx, instance)
+	var metrics []prometheus.Metric
+	for _, metric := range gathered {
+		if metric.Desc() != p.up {
+			metrics = append(metrics, metric)
+		}
+	}
+
+	snapshot.mutex.Lock()
+	defer snapshot.mutex.Unlock()
+	snapshot.polled = true
+	snapshot.up = up
+	snapshot.model = p.model(instance)
+	snapshot.metrics = nil
+	if up {
+		snapshot.metrics = metrics
+		snapshot.lastSuccess = time.Now()
+	}
+}
+
+// collectSnapshot sends the last snapshot of an instance, with how old it is.
+// After a failed poll only up and the time of the last success are sent, so
+// that old channel metrics aren't taken for current ones.
+func (p *Exporter) collectSnapshot(ch chan<- prometheus.Metric, instance *config.InstancesConfig, snapshot *snapshot) {
+	snapshot.mutex.Lock()
+	defer snapshot.mutex.Unlock()
+
+	// Nothing to report until the first poll
+	if !snapshot.polled {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(p.up, prometheus.GaugeValue, boolToFloat(snapshot.up), instance.Name, instance.Address, snapshot.model)
+	if snapshot.lastSuccess.IsZero() {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(p.lastSuccess, prometheus.GaugeValue, float64(snapshot.lastSuccess.UnixNano())/1e9, instance.Name, instance.Address, snapshot.model)
+	if !snapshot.up {
+		return
+	}
+	for _, metric := range snapshot.metrics {
+		ch <- metric
+	}
+	ch <- prometheus.MustNewConstMetric(p.snapshotAge, prometheus.GaugeValue, time.Since(snapshot.lastSuccess).Seconds(), instance.Name, instance.Address, snapshot.model)
+}
@@ -0,0 +1,91 @@
+package collectors
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"hub4_exporter/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolling(t *testing.T) {
+	server := newHub4Server(t, readTestdata(t, "hub4_networkstatus.json"))
+	conf, err := config.ConfigParse(strings.NewReader(`
+poll_interval: 20ms
+instances:
+  - name: hub
+    address: ` + strings.TrimPrefix(server.URL, "http://") + `
+    type: hub4
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := conf.Instances[0].Address
+	p := PromExporter(time.Second, conf)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(p)
+
+	// waitFor gathers until cond holds for the instance's metrics
+	waitFor := func(what string, cond func(families []*dto.MetricFamily) bool) []*dto.MetricFamily {
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(5 * time.Millisecond) {
+			families, err := registry.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cond(families) {
+				return families
+			}
+		}
+		t.Fatalf("timed out waiting for %s", what)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.StartPolling(ctx)
+
+	families := waitFor("the first poll", func(families []*dto.MetricFamily) bool {
+		return gauges(t, families, "hub4_up")[address] == 1
+	})
+	firstSuccess := gauges(t, families, "hub4_last_success_timestamp_seconds")[address]
+	if firstSuccess == 0 {
+		t.Fatal("no hub4_last_success_timestamp_seconds after a successful poll")
+	}
+	if _, ok := gauges(t, families, "hub4_snapshot_age_seconds")[address]; !ok {
+		t.Error("no hub4_snapshot_age_seconds after a successful poll")
+	}
+
+	// Later polls move the last success on
+	families = waitFor("a later poll", func(families []*dto.MetricFamily) bool {
+		return gauges(t, families, "hub4_last_success_timestamp_seconds")[address] > firstSuccess
+	})
+
+	// Once the modem goes away scrapes are only told it's down and when it
+	// was last polled, not served the old channel metrics
+	server.Close()
+	families = waitFor("a failed poll", func(families []*dto.MetricFamily) bool {
+		return gauges(t, families, "hub4_up")[address] == 0
+	})
+	lastSuccess := gauges(t, families, "hub4_last_success_timestamp_seconds")[address]
+	if lastSuccess == 0 {
+		t.Error("no hub4_last_success_timestamp_seconds after a failed poll")
+	}
+	for _, name := range []string{"hub4_aquired_DS_channel", "hub4_snapshot_age_seconds"} {
+		if _, ok := gauges(t, families, name)[address]; ok {
+			t.Errorf("got %s after a failed poll", name)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	families, err = registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gauges(t, families, "hub4_last_success_timestamp_seconds")[address]; got != lastSuccess {
+		t.Errorf("got last success %v after failed polls, want %v", got, lastSuccess)
+	}
+	if got := gauges(t, families, "hub4_up")[address]; got != 0 {
+		t.Errorf("got hub4_up %v after failed polls, want 0", got)
+	}
+}
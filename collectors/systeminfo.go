@@ -0,0 +1,133 @@
+package collectors
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"hub4_exporter/config"
+	"hub4_exporter/drivers"
+	"hub4_exporter/hub4"
+	"sync"
+	"time"
+)
+
+const hub4SystemInfoPath = "/php/ajaxGet_device_systeminfo_data.php"
+
+// uptimeTracker remembers the last uptime read from each instance, so that
+// the uptime going backwards can be counted as a reboot, and the boot time
+// worked out after the last reboot so that it doesn't jitter between scrapes
+type uptimeTracker struct {
+	mutex sync.Mutex
+	last  map[string]uptimeRead
+}
+
+type uptimeRead struct {
+	uptime   float64
+	bootTime time.Time
+}
+
+func newUptimeTracker() *uptimeTracker {
+	return &uptimeTracker{
+		last: map[string]uptimeRead{},
+	}
+}
+
+// update remembers the uptime of an instance read at now, returning its
+// boot time and whether it has rebooted since the last read
+func (t *uptimeTracker) update(instance string, uptime float64, now time.Time) (time.Time, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	last, ok := t.last[instance]
+	rebooted := ok && uptime < last.uptime
+	bootTime := last.bootTime
+	if !ok || rebooted {
+		bootTime = bootTimeAt(uptime, now)
+	}
+	t.last[instance] = uptimeRead{uptime: uptime, bootTime: bootTime}
+	return bootTime, rebooted
+}
+
+// bootTimeAt works out the boot time from the uptime read at now, to the
+// second
+func bootTimeAt(uptime float64, now time.Time) time.Time {
+	return now.Add(-time.Duration(uptime * float64(time.Second))).Round(time.Second)
+}
+
+// collectSystemInfo reports a Hub 4's uptime, firmware and hardware
+func (p *Exporter) collectSystemInfo(ctx context.Context, ch chan<- prometheus.Metric, instance *config.InstancesConfig, session *drivers.Hub4Session, probe bool) error {
+	body, err := session.Get(ctx, hub4SystemInfoPath)
+	if err != nil {
+		return err
+	}
+	info, err := hub4.DecodeSystemInfo(body)
+	if err != nil {
+		return err
+	}
+
+	model := p.model(instance)
+	serial := info.SerialNumber
+	if instance.HashSerial {
+		serial = p.hashLabel(serial)
+	}
+	// Probes have no earlier read to keep the boot time from
+	bootTime := bootTimeAt(info.Uptime, time.Now())
+	if !probe {
+		var rebooted bool
+		bootTime, rebooted = p.uptimes.update(instance.Key, info.Uptime, time.Now())
+		if rebooted {
+			p.reboots.WithLabelValues(instance.Name, instance.Address, model).Inc()
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(p.uptime, prometheus.GaugeValue, info.Uptime, instance.Name, instance.Address, model)
+	ch <- prometheus.MustNewConstMetric(p.bootTime, prometheus.GaugeValue, float64(bootTime.Unix()), instance.Name, instance.Address, model)
+	ch <- prometheus.MustNewConstMetric(p.systemInfo, prometheus.GaugeValue, float64(1), instance.Name, instance.Address, model,
+		info.SoftwareVersion, info.ModelName, info.HardwareVersion, serial)
+	return nil
+}
+
+// newHashKey returns the configured key for hashLabel, or a random one. A
+// random key changes the hashes each time the exporter starts, so it's
+// warned about when anything is hashed.
+func newHashKey(conf *config.Config) []byte {
+	if conf.HashKey != "" {
+		return []byte(conf.HashKey)
+	}
+	if hashesLabels(conf) {
+		log.Warn("Hashing serial numbers or client details without a hash_key, the hashes will change each time the exporter restarts")
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatalf("Unable to generate a hash key: %s", err)
+	}
+	return key
+}
+
+// hashesLabels returns whether any instance or module hashes its serial
+// number or client details
+func hashesLabels(conf *config.Config) bool {
+	for _, instance := range conf.Instances {
+		if instance.HashSerial || (instance.Clients != nil && instance.Clients.HashLabels) {
+			return true
+		}
+	}
+	for _, module := range conf.Modules {
+		if module.HashSerial || (module.Clients != nil && module.Clients.HashLabels) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashLabel hides an identifier such as a serial number, while keeping it
+// distinct from others. It's keyed so that short identifiers such as MAC
+// addresses can't be found by hashing every possible value.
+func (p *Exporter) hashLabel(value string) string {
+	mac := hmac.New(sha256.New, p.hashKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
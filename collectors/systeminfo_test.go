@@ -0,0 +1,126 @@
+package collectors
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"hub4_exporter/config"
+	"hub4_exporter/drivers"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUptimeTrackerBootTime(t *testing.T) {
+	tracker := newUptimeTracker()
+	start := time.Unix(1600000000, 0)
+
+	first, rebooted := tracker.update("0/hub", 100, start.Add(300*time.Millisecond))
+	if rebooted {
+		t.Error("first read counted as a reboot")
+	}
+	if want := start.Add(-100 * time.Second); !first.Equal(want) {
+		t.Errorf("boot time = %s, want %s", first, want)
+	}
+
+	// The uptime is read a little late, which mustn't move the boot time
+	bootTime, rebooted := tracker.update("0/hub", 160, start.Add(61*time.Second+700*time.Millisecond))
+	if rebooted || !bootTime.Equal(first) {
+		t.Errorf("got boot time %s and reboot %t, want %s and false", bootTime, rebooted, first)
+	}
+
+	bootTime, rebooted = tracker.update("0/hub", 5, start.Add(120*time.Second))
+	if want := start.Add(115 * time.Second); !rebooted || !bootTime.Equal(want) {
+		t.Errorf("got boot time %s and reboot %t after a reboot, want %s and true", bootTime, rebooted, want)
+	}
+}
+
+func TestHashLabel(t *testing.T) {
+	p := &Exporter{hashKey: newHashKey(&config.Config{HashKey: "key"})}
+	other := &Exporter{hashKey: newHashKey(&config.Config{HashKey: "other key"})}
+	random := &Exporter{hashKey: newHashKey(&config.Config{})}
+
+	hash := p.hashLabel("aa:bb:cc:dd:ee:ff")
+	if hash != p.hashLabel("aa:bb:cc:dd:ee:ff") {
+		t.Error("hash of the same value with the same key changed")
+	}
+	if hash == p.hashLabel("aa:bb:cc:dd:ee:00") {
+		t.Error("different values hashed the same")
+	}
+	if hash == other.hashLabel("aa:bb:cc:dd:ee:ff") || hash == random.hashLabel("aa:bb:cc:dd:ee:ff") {
+		t.Error("different keys hashed the same")
+	}
+}
+
+func TestHashesLabels(t *testing.T) {
+	for _, test := range []struct {
+		conf *config.Config
+		want bool
+	}{
+		{&config.Config{Instances: []*config.InstancesConfig{{}}}, false},
+		{&config.Config{Instances: []*config.InstancesConfig{{Clients: &config.ClientsConfig{}}}}, false},
+		{&config.Config{Instances: []*config.InstancesConfig{{HashSerial: true}}}, true},
+		{&config.Config{Instances: []*config.InstancesConfig{{Clients: &config.ClientsConfig{HashLabels: true}}}}, true},
+		{&config.Config{Modules: map[string]*config.ModuleConfig{"hub4": {HashSerial: true}}}, true},
+	} {
+		if got := hashesLabels(test.conf); got != test.want {
+			t.Errorf("got %t for %+v, want %t", got, test.conf, test.want)
+		}
+	}
+}
+
+func TestCollectSystemInfo(t *testing.T) {
+	pages := map[string][]byte{}
+	server, _ := newHub4AdminServer(t, pages)
+	instance := &config.InstancesConfig{
+		Name:        "hub",
+		Address:     strings.TrimPrefix(server.URL, "http://"),
+		Key:         "0/hub",
+		Type:        "hub4",
+		Credentials: &config.CredentialsConfig{Password: "secret"},
+	}
+	p := PromExporter(5*time.Second, &config.Config{Instances: []*config.InstancesConfig{instance}})
+	session, err := drivers.NewHub4Session(http.DefaultClient, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		page  string
+		model string
+	}{
+		{`["2.0","9.1.2012.300","ABC123","3600","F3896LG"]`, "F3896LG"},
+		// Older firmware doesn't send the model
+		{`["2.0","9.1.2004.100","ABC123","3600"]`, ""},
+	} {
+		pages[hub4SystemInfoPath] = []byte(test.page)
+		ch := make(chan prometheus.Metric, 10)
+		if err := p.collectSystemInfo(context.Background(), ch, instance, session, true); err != nil {
+			t.Fatal(err)
+		}
+		close(ch)
+
+		found := false
+		for metric := range ch {
+			if metric.Desc() != p.systemInfo {
+				continue
+			}
+			found = true
+			var m dto.Metric
+			if err := metric.Write(&m); err != nil {
+				t.Fatal(err)
+			}
+			labels := map[string]string{}
+			for _, label := range m.Label {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["hardware_model"] != test.model || labels["hardware_version"] != "2.0" || labels["model"] != "hub4" {
+				t.Errorf("%s: got labels %v, want hardware model %q", test.page, labels, test.model)
+			}
+		}
+		if !found {
+			t.Errorf("%s: no hub4_system_info", test.page)
+		}
+	}
+}
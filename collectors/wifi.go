@@ -0,0 +1,106 @@
+package collectors
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"hub4_exporter/config"
+	"hub4_exporter/drivers"
+	"hub4_exporter/hub4"
+	"strconv"
+	"sync"
+)
+
+const (
+	hub4WifiStatusPath = "/php/ajaxGet_device_wifi_status_data.php"
+	hub4WifiScanPath   = "/php/ajaxGet_device_wifi_scan_data.php"
+)
+
+// wifiScanSupport remembers the instances whose firmware doesn't have the
+// Wi-Fi scan page, so it isn't asked for on every scrape
+type wifiScanSupport struct {
+	mutex       sync.Mutex
+	unsupported map[string]bool
+}
+
+func newWifiScanSupport() *wifiScanSupport {
+	return &wifiScanSupport{
+		unsupported: map[string]bool{},
+	}
+}
+
+func (s *wifiScanSupport) supported(instance string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return !s.unsupported[instance]
+}
+
+func (s *wifiScanSupport) setUnsupported(instance string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.unsupported[instance] = true
+}
+
+// collectWifi reports a Hub 4's Wi-Fi radios, and the networks around it if
+// the firmware has a Wi-Fi scan. Radios are labelled by their position as
+// well as their band, as a hub can have two radios on the same band.
+func (p *Exporter) collectWifi(ctx context.Context, ch chan<- prometheus.Metric, instance *config.InstancesConfig, session *drivers.Hub4Session, probe bool) error {
+	body, err := session.Get(ctx, hub4WifiStatusPath)
+	if err != nil {
+		return err
+	}
+	radios, err := hub4.DecodeRadios(body)
+	if err != nil {
+		return err
+	}
+
+	model := p.model(instance)
+	for i, radio := range radios {
+		index, band := strconv.Itoa(i), clientLabel(radio.Band)
+		ch <- prometheus.MustNewConstMetric(p.wifiRadioInfo, prometheus.GaugeValue, float64(1), instance.Name, instance.Address, model,
+			index, band, radio.Channel, clientLabel(radio.Bandwidth), radio.Mode)
+		ch <- prometheus.MustNewConstMetric(p.wifiRadioEnabled, prometheus.GaugeValue, boolToFloat(radio.Enabled), instance.Name, instance.Address, model, index, band)
+		ch <- prometheus.MustNewConstMetric(p.wifiRadioClients, prometheus.GaugeValue, radio.Clients, instance.Name, instance.Address, model, index, band)
+	}
+
+	// Firmware without the scan doesn't have the page, which is remembered
+	// for configured instances rather than asked for again
+	if !probe && !p.wifiScans.supported(instance.Key) {
+		return nil
+	}
+	body, err = session.Get(ctx, hub4WifiScanPath)
+	if errors.Is(err, drivers.ErrPageNotFound) {
+		log.Debugf("No Wi-Fi scan from instance %s: %s", instance.Name, err)
+		if !probe {
+			p.wifiScans.setUnsupported(instance.Key)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	neighbours, err := hub4.DecodeNeighbours(body)
+	if err != nil {
+		return err
+	}
+
+	// Networks are reported by channel, as there can be many of them
+	type key struct{ band, channel string }
+	counts := map[key]int{}
+	strongest := map[key]float64{}
+	for _, neighbour := range neighbours {
+		k := key{clientLabel(neighbour.Band), neighbour.Channel}
+		if signal, ok := strongest[k]; !ok || neighbour.Signal > signal {
+			strongest[k] = neighbour.Signal
+		}
+		counts[k]++
+	}
+	for k, count := range counts {
+		ch <- prometheus.MustNewConstMetric(p.wifiNeighbours, prometheus.GaugeValue, float64(count), instance.Name, instance.Address, model, k.band, k.channel)
+		ch <- prometheus.MustNewConstMetric(p.wifiNeighbourSignal, prometheus.GaugeValue, strongest[k], instance.Name, instance.Address, model, k.band, k.channel)
+	}
+	return nil
+}
@@ -2,19 +2,179 @@ package config
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"gopkg.in/yaml.v2"
 	"io"
 	"io/ioutil"
+	"os"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Instances []*InstancesConfig `yaml:"instances,omitempty"`
-	Port string `yaml:"port,omitempty"`
+	Instances     []*InstancesConfig `yaml:"instances,omitempty"`
+	Port          string             `yaml:"port,omitempty"`
+	ListenAddress string             `yaml:"listen_address,omitempty"`
+	TelemetryPath string             `yaml:"telemetry_path,omitempty"`
+	LogLevel      string             `yaml:"log_level,omitempty"`
+	// Default timeout for fetching from an instance
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Poll instances in the background this often, serving scrapes from the
+	// last poll. Instances are fetched on each scrape when 0.
+	PollInterval time.Duration `yaml:"poll_interval,omitempty"`
+	// Default retries and circuit breaker for instances
+	Retry          *RetryConfig          `yaml:"retry,omitempty"`
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
+	// Settings for targets of /probe, by module name
+	Modules map[string]*ModuleConfig `yaml:"modules,omitempty"`
+	// Key for hashing serial numbers and client details. A random key is
+	// used when empty, so the hashes change when the exporter restarts.
+	HashKey string `yaml:"hash_key,omitempty"`
 }
 
 type InstancesConfig struct {
-	Name     string `yaml:"name,omitempty"`
-	Address  string   `yaml:"address"`
+	Name    string `yaml:"name,omitempty"`
+	Address string `yaml:"address"`
+	// Modem driver, detected when empty or auto
+	Type string `yaml:"type,omitempty"`
+	// Overrides the global timeout for this instance
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Overrides the global poll interval for this instance
+	PollInterval time.Duration `yaml:"poll_interval,omitempty"`
+	// Override the global retries and circuit breaker for this instance
+	Retry          *RetryConfig          `yaml:"retry,omitempty"`
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
+	// Settings for the snmp driver
+	SNMP *SNMPConfig `yaml:"snmp,omitempty"`
+	// Settings for the html driver
+	HTML *HTMLConfig `yaml:"html,omitempty"`
+	// Settings for the HTTP client
+	HTTP *HTTPConfig `yaml:"http,omitempty"`
+	// Login for the admin web UI
+	Credentials *CredentialsConfig `yaml:"credentials,omitempty"`
+	// Report a hash of the serial number rather than the serial number
+	HashSerial bool `yaml:"hash_serial,omitempty"`
+	// Settings for reporting connected devices
+	Clients *ClientsConfig `yaml:"clients,omitempty"`
+
+	// Key identifies the instance in the exporter, as names can be empty or
+	// repeated. It's set when the config is parsed.
+	Key string `yaml:"-"`
+}
+
+// ModuleConfig holds the settings of an instance, for /probe targets
+type ModuleConfig struct {
+	// Modem driver, detected when empty or auto
+	Type        string             `yaml:"type,omitempty"`
+	Timeout     time.Duration      `yaml:"timeout,omitempty"`
+	SNMP        *SNMPConfig        `yaml:"snmp,omitempty"`
+	HTML        *HTMLConfig        `yaml:"html,omitempty"`
+	HTTP        *HTTPConfig        `yaml:"http,omitempty"`
+	Retry       *RetryConfig       `yaml:"retry,omitempty"`
+	Credentials *CredentialsConfig `yaml:"credentials,omitempty"`
+	HashSerial  bool               `yaml:"hash_serial,omitempty"`
+	Clients     *ClientsConfig     `yaml:"clients,omitempty"`
+}
+
+// Instance returns the settings for probing target with the module, the
+// target is used for the instance's name and address
+func (m *ModuleConfig) Instance(target string) *InstancesConfig {
+	return &InstancesConfig{
+		Name:        target,
+		Address:     target,
+		Key:         "probe/" + target,
+		Type:        m.Type,
+		Timeout:     m.Timeout,
+		SNMP:        m.SNMP,
+		HTML:        m.HTML,
+		HTTP:        m.HTTP,
+		Retry:       m.Retry,
+		Credentials: m.Credentials,
+		HashSerial:  m.HashSerial,
+		Clients:     m.Clients,
+	}
+}
+
+type CredentialsConfig struct {
+	// Defaults to admin
+	Username string `yaml:"username,omitempty"`
+	// The password is given inline, read from an environment variable or
+	// read from a file
+	Password     string `yaml:"password,omitempty"`
+	PasswordEnv  string `yaml:"password_env,omitempty"`
+	PasswordFile string `yaml:"password_file,omitempty"`
+}
+
+// LoadPassword returns the password from wherever it's configured, the
+// environment and file are read each time so they can be changed
+func (c *CredentialsConfig) LoadPassword() (string, error) {
+	switch {
+	case c.Password != "":
+		return c.Password, nil
+	case c.PasswordEnv != "":
+		password, ok := os.LookupEnv(c.PasswordEnv)
+		if !ok {
+			return "", fmt.Errorf("password environment variable %s isn't set", c.PasswordEnv)
+		}
+		return password, nil
+	case c.PasswordFile != "":
+		buffer, err := ioutil.ReadFile(c.PasswordFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(buffer), "\r\n"), nil
+	}
+	return "", errors.New("no password configured")
+}
+
+type ClientsConfig struct {
+	// Report each device in hub4_client_info
+	Info bool `yaml:"info,omitempty"`
+	// Most devices reported in hub4_client_info, defaults to 100
+	MaxClients int `yaml:"max_clients,omitempty"`
+	// Report hashes of hostnames and IP addresses, MAC addresses are
+	// always hashed
+	HashLabels bool `yaml:"hash_labels,omitempty"`
+}
+
+type RetryConfig struct {
+	// Retries after a failed fetch, defaults to 0
+	Attempts int `yaml:"attempts,omitempty"`
+	// Wait before the first retry, doubled for each retry after, defaults
+	// to 1s. Retries stop when the wait would run past the timeout.
+	Backoff time.Duration `yaml:"backoff,omitempty"`
+}
+
+type CircuitBreakerConfig struct {
+	// Failed scrapes in a row before scrapes fail fast, 0 disables the breaker
+	FailureThreshold int `yaml:"failure_threshold,omitempty"`
+	// How long scrapes fail fast before one is let through, defaults to 1m
+	OpenDuration time.Duration `yaml:"open_duration,omitempty"`
+}
+
+type HTTPConfig struct {
+	// Close the connection after each request
+	DisableKeepAlives bool `yaml:"disable_keep_alives,omitempty"`
+	// How long an unused connection is kept open, defaults to 90s
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"`
+	// Largest response read in bytes, defaults to 10MiB
+	MaxResponseSize int64 `yaml:"max_response_size,omitempty"`
+	// Connect from the address of this network interface
+	SourceInterface string `yaml:"source_interface,omitempty"`
+}
+
+type SNMPConfig struct {
+	// 1, 2 (for 2c) or 3, defaults to 2
+	Version   int    `yaml:"version,omitempty"`
+	Community string `yaml:"community,omitempty"`
+	// SNMP v3
+	Username      string `yaml:"username,omitempty"`
+	SecurityLevel string `yaml:"security_level,omitempty"`
+	AuthProtocol  string `yaml:"auth_protocol,omitempty"`
+	AuthPassword  string `yaml:"auth_password,omitempty"`
+	PrivProtocol  string `yaml:"priv_protocol,omitempty"`
+	PrivPassword  string `yaml:"priv_password,omitempty"`
 }
 
 func ConfigParse(r io.Reader) (*Config, error) {
@@ -31,12 +191,24 @@ func ConfigParse(r io.Reader) (*Config, error) {
 		return nil, err
 	}
 
+	for i, instance := range config.Instances {
+		if instance == nil {
+			return nil, fmt.Errorf("instance %d has no settings", i)
+		}
+		instance.Key = fmt.Sprintf("%d/%s", i, instance.Address)
+	}
+	// A module without settings detects the modem, like no module
+	for name, module := range config.Modules {
+		if module == nil {
+			config.Modules[name] = &ModuleConfig{}
+		}
+	}
 	return config, nil
 }
 
-func ConfigLoadFromFile() (*Config, error) {
+func ConfigLoadFromFile(path string) (*Config, error) {
 	// Load from file
-	buffer, err := ioutil.ReadFile("config.yaml")
+	buffer, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
@@ -50,5 +222,43 @@ func ConfigLoadFromFile() (*Config, error) {
 	if config.Port == "" {
 		config.Port = "9879"
 	}
+	// Listen address takes precedence over port
+	if config.ListenAddress == "" {
+		config.ListenAddress = ":" + config.Port
+	}
+	if config.TelemetryPath == "" {
+		config.TelemetryPath = "/metrics"
+	}
+	if config.LogLevel == "" {
+		config.LogLevel = "info"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = time.Second * 10
+	}
 	return config, nil
-}
\ No newline at end of file
+}
+
+type HTMLConfig struct {
+	// Built in page layout, such as sb8200 or cm1000
+	Model string `yaml:"model,omitempty"`
+	// Override the model's status page and tables
+	Path       string           `yaml:"path,omitempty"`
+	Downstream *HTMLTableConfig `yaml:"downstream,omitempty"`
+	Upstream   *HTMLTableConfig `yaml:"upstream,omitempty"`
+	// Tables of DOCSIS 3.1 channels, for modems that list them separately
+	DownstreamOFDM *HTMLTableConfig `yaml:"downstream_ofdm,omitempty"`
+	UpstreamOFDMA  *HTMLTableConfig `yaml:"upstream_ofdma,omitempty"`
+}
+
+type HTMLTableConfig struct {
+	// The table is found by its id attribute, or by text in its first row
+	ID    string `yaml:"id,omitempty"`
+	Title string `yaml:"title,omitempty"`
+	// Read the table from the tagValueList in this JavaScript function
+	// instead, for modems that fill their tables in with JavaScript
+	Script string `yaml:"script,omitempty"`
+	// Header rows to skip
+	HeaderRows int `yaml:"header_rows,omitempty"`
+	// Column number, counting from 0, of each field
+	Columns map[string]int `yaml:"columns"`
+}
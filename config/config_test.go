@@ -0,0 +1,26 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigParseEmptyModule(t *testing.T) {
+	config, err := ConfigParse(strings.NewReader("modules:\n  foo:\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	module, ok := config.Modules["foo"]
+	if !ok || module == nil {
+		t.Fatalf("got module %v, want empty settings", module)
+	}
+	if instance := module.Instance("192.168.100.1"); instance.Type != "" || instance.Address != "192.168.100.1" {
+		t.Errorf("got instance %+v", instance)
+	}
+}
+
+func TestConfigParseEmptyInstance(t *testing.T) {
+	if _, err := ConfigParse(strings.NewReader("instances:\n  -\n")); err == nil {
+		t.Error("got no error for an instance without settings")
+	}
+}
@@ -0,0 +1,129 @@
+package docsis
+
+import "strings"
+
+// Status is the state of a cable modem, read by a driver. Fields a driver
+// can't read are left nil or empty.
+type Status struct {
+	Modem        *Modem
+	ServiceFlows *ServiceFlows
+	Counts       ChannelCounts
+	DSChannels   []DSChannel
+	USChannels   []USChannel
+	DS31Channels []DS31Channel
+	US31Channels []US31Channel
+}
+
+// Modem is the modem's registration state
+type Modem struct {
+	AcquiredDSChannel       int64 // Hz
+	RangedUSChannel         int64 // Hz
+	AcquiredDSChannelStatus string
+	RangedUSChannelStatus   string
+	ProvisioningState       float64
+	NetworkAccess           bool
+	MaxCPE                  float64
+	BPIState                bool
+	DOCSISVersion           float64
+	BootFile                string
+	SchedulingType          string
+	PrimaryChannelType      string
+}
+
+// ServiceFlows are the primary downstream and upstream service flows
+type ServiceFlows struct {
+	DSFlowID               float64
+	DSMaxTrafficRate       float64
+	DSMaxTrafficBurst      float64
+	DSMinTrafficRate       float64
+	USFlowID               float64
+	USMaxTrafficRate       float64
+	USMaxTrafficBurst      float64
+	USMinTrafficRate       float64
+	USMaxConcatenatedBurst float64
+}
+
+// ChannelCounts are the number of channels of each type in use
+type ChannelCounts struct {
+	DS   float64
+	US   float64
+	DS31 float64
+	US31 float64
+}
+
+// DSChannel is a DOCSIS 3.0 (SC-QAM) downstream channel
+type DSChannel struct {
+	ID           int64
+	Frequency    int64   // Hz
+	Power        float64 // dBmV
+	SNR          float64 // dB
+	Modulation   string
+	Locked       bool
+	RxMER        float64 // dB
+	PreRSErrors  float64
+	PostRSErrors float64
+}
+
+// USChannel is a DOCSIS 3.0 (SC-QAM) upstream channel
+type USChannel struct {
+	ID          int64
+	Frequency   int64   // Hz
+	Power       float64 // dBmV
+	SymbolRate  string
+	Modulation  string
+	ChannelType string
+	T1Timeouts  float64
+	T2Timeouts  float64
+	T3Timeouts  float64
+	T4Timeouts  float64
+}
+
+// DS31Channel is a DOCSIS 3.1 (OFDM) downstream channel
+type DS31Channel struct {
+	ID              int64
+	ChannelWidth    float64 // MHz
+	FFTType         string
+	Subcarriers     int64
+	Modulation      string
+	FirstSubcarrier int64 // Hz
+	Locked          bool
+	RxMER           float64 // dB
+	PLCPower        float64 // dBmV
+	PreRSErrors     float64
+	PostRSErrors    float64
+}
+
+// US31Channel is a DOCSIS 3.1 (OFDMA) upstream channel
+type US31Channel struct {
+	ID          int64
+	Frequency   int64   // Hz
+	Power       float64 // dBmV
+	FFTType     string
+	Modulation  string
+	ChannelType string
+	T1Timeouts  float64
+	T2Timeouts  float64
+	T3Timeouts  float64
+	T4Timeouts  float64
+}
+
+// Subcarrier spacing in Hz for each DS 3.1 FFT type
+var subcarrierSpacing = map[string]int64{
+	"4K": 50000,
+	"8K": 25000,
+}
+
+// FrequencyRange returns the start and end frequency of the channel in Hz.
+// The end is worked out from the subcarrier count and the FFT type's
+// subcarrier spacing, or from the channel width if the FFT type is unknown.
+// Both are 0 when the driver can't read the first subcarrier's frequency.
+func (c DS31Channel) FrequencyRange() (start int64, end int64) {
+	start = c.FirstSubcarrier
+	if start == 0 {
+		return 0, 0
+	}
+	if spacing, ok := subcarrierSpacing[strings.ToUpper(c.FFTType)]; ok && c.Subcarriers > 0 {
+		return start, start + c.Subcarriers*spacing
+	}
+	return start, start + int64(c.ChannelWidth*1000000)
+}
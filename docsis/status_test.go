@@ -0,0 +1,21 @@
+package docsis
+
+import "testing"
+
+func TestDS31FrequencyRange(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		channel    DS31Channel
+		start, end int64
+	}{
+		{"4K FFT", DS31Channel{FirstSubcarrier: 148000000, FFTType: "4K", Subcarriers: 1880, ChannelWidth: 96}, 148000000, 242000000},
+		{"8K FFT", DS31Channel{FirstSubcarrier: 148000000, FFTType: "8k", Subcarriers: 3760}, 148000000, 242000000},
+		{"unknown FFT", DS31Channel{FirstSubcarrier: 148000000, ChannelWidth: 94}, 148000000, 242000000},
+		{"no subcarriers", DS31Channel{FirstSubcarrier: 148000000, FFTType: "4K", ChannelWidth: 94}, 148000000, 242000000},
+		{"no first subcarrier", DS31Channel{FFTType: "4K", Subcarriers: 1880, ChannelWidth: 96}, 0, 0},
+	} {
+		if start, end := test.channel.FrequencyRange(); start != test.start || end != test.end {
+			t.Errorf("%s: got %d-%d, want %d-%d", test.name, start, end, test.start, test.end)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hub4_exporter/config"
+	"net/http"
+)
+
+// probes are the modems Detect tries in order, the Hub 4 first as it's the
+// most common. SNMP is tried last as it can only time out when nothing answers.
+var probes = []struct {
+	modemType string
+	html      *config.HTMLConfig
+}{
+	{modemType: "hub4"},
+	{modemType: "hub3"},
+	{modemType: "hub5"},
+	{modemType: "html", html: &config.HTMLConfig{Model: "sb8200"}},
+	{modemType: "html", html: &config.HTMLConfig{Model: "cm1000"}},
+}
+
+// Detect finds which modem is at an instance's address, returning a copy of
+// the instance with its type set. Each HTTP modem is tried by fetching and
+// decoding its status, then SNMP by reading sysDescr.
+func Detect(ctx context.Context, httpClient *http.Client, instance *config.InstancesConfig) (*config.InstancesConfig, error) {
+	var firstErr error
+	fetched := false
+	for _, probe := range probes {
+		if ctx.Err() != nil {
+			break
+		}
+		candidate := *instance
+		candidate.Type = probe.modemType
+		if probe.html != nil {
+			// The configured page and tables override the probe's layout
+			html := *probe.html
+			if instance.HTML != nil {
+				html = *instance.HTML
+				if html.Model == "" {
+					html.Model = probe.html.Model
+				}
+			}
+			candidate.HTML = &html
+		}
+		driver, err := Get(candidate.Type)
+		if err != nil {
+			return nil, err
+		}
+		body, err := driver.Fetch(ctx, httpClient, &candidate)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		fetched = true
+		if _, err := driver.Decode(&candidate, body); err != nil {
+			continue
+		}
+		return &candidate, nil
+	}
+
+	if ctx.Err() == nil {
+		candidate := *instance
+		candidate.Type = "snmp"
+		if _, err := snmpSysDescr(ctx, &candidate); err == nil {
+			return &candidate, nil
+		}
+	}
+
+	// A modem that answered but couldn't be decoded is a parse error,
+	// otherwise report why the first probe couldn't connect
+	err := fmt.Errorf("no known modem found at %s", instance.Address)
+	if fetched {
+		return nil, &FetchError{Reason: ReasonParseError, Err: err}
+	}
+	var fetchErr *FetchError
+	if errors.As(firstErr, &fetchErr) {
+		return nil, &FetchError{Reason: fetchErr.Reason, Err: fmt.Errorf("%s: %w", err, fetchErr.Err)}
+	}
+	if firstErr != nil {
+		return nil, &FetchError{Reason: ReasonConnectionError, Err: fmt.Errorf("%s: %w", err, firstErr)}
+	}
+	return nil, &FetchError{Reason: ReasonTimeout, Err: err}
+}
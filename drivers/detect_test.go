@@ -0,0 +1,61 @@
+package drivers
+
+import (
+	"context"
+	"hub4_exporter/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func detect(t *testing.T, instance *config.InstancesConfig) (*config.InstancesConfig, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return Detect(ctx, http.DefaultClient, instance)
+}
+
+func TestDetectHub3(t *testing.T) {
+	server := newFixtureServer(t, map[string]string{"/getRouterStatus": "hub3_routerstatus.json"})
+
+	detected, err := detect(t, testInstance(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detected.Type != "hub3" {
+		t.Errorf("detected %s, want hub3", detected.Type)
+	}
+}
+
+func TestDetectConfiguredHTMLPage(t *testing.T) {
+	server := newFixtureServer(t, map[string]string{"/status/docsis.html": "sb8200_cmconnectionstatus.html"})
+	instance := testInstance(server)
+	instance.HTML = &config.HTMLConfig{Path: "/status/docsis.html"}
+
+	detected, err := detect(t, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detected.Type != "html" || detected.HTML.Model != "sb8200" || detected.HTML.Path != "/status/docsis.html" {
+		t.Errorf("detected %s with %+v, want html with the sb8200 layout at the configured path", detected.Type, detected.HTML)
+	}
+	if instance.HTML.Model != "" {
+		t.Error("detection changed the configured instance")
+	}
+}
+
+func TestDetectUnknown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	detected, err := detect(t, testInstance(server))
+	if err == nil {
+		t.Fatalf("detected %s, want an error", detected.Type)
+	}
+	if reason := ErrorReason(err); reason != ReasonParseError {
+		t.Errorf("got reason %s, want %s", reason, ReasonParseError)
+	}
+}
@@ -0,0 +1,238 @@
+package drivers
+
+import (
+	"errors"
+	"hub4_exporter/docsis"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Table entries from DOCS-IF-MIB, DOCS-IF3-MIB and DOCS-IF31-MIB, column
+// numbers are given with the code reading them
+const (
+	oidDownstreamChannelEntry    = "1.3.6.1.2.1.10.127.1.1.1.1"
+	oidUpstreamChannelEntry      = "1.3.6.1.2.1.10.127.1.1.2.1"
+	oidSignalQualityEntry        = "1.3.6.1.2.1.10.127.1.1.4.1"
+	oidCmStatusUsEntry           = "1.3.6.1.4.1.4491.2.1.20.1.2.1"
+	oidSignalQualityExtEntry     = "1.3.6.1.4.1.4491.2.1.20.1.24.1"
+	oidCmDsOfdmChanEntry         = "1.3.6.1.4.1.4491.2.1.28.1.9.1"
+	oidCmDsOfdmProfileStatsEntry = "1.3.6.1.4.1.4491.2.1.28.1.10.1"
+	oidCmDsOfdmChannelPowerEntry = "1.3.6.1.4.1.4491.2.1.28.1.11.1"
+	oidCmUsOfdmaChanEntry        = "1.3.6.1.4.1.4491.2.1.28.1.13.1"
+)
+
+// MIBTables lists the tables decodeDocsIfMIB reads
+var MIBTables = []string{
+	oidDownstreamChannelEntry,
+	oidUpstreamChannelEntry,
+	oidSignalQualityEntry,
+	oidCmStatusUsEntry,
+	oidSignalQualityExtEntry,
+	oidCmDsOfdmChanEntry,
+	oidCmDsOfdmProfileStatsEntry,
+	oidCmDsOfdmChannelPowerEntry,
+	oidCmUsOfdmaChanEntry,
+}
+
+// mibTable holds the columns of a MIB table by row index
+type mibTable map[string]map[int]string
+
+// newMIBTable picks the rows of the table with the given entry OID out of a
+// set of OID values
+func newMIBTable(values map[string]string, entry string) mibTable {
+	table := mibTable{}
+	prefix := strings.TrimPrefix(entry, ".") + "."
+	for oid, value := range values {
+		oid = strings.TrimPrefix(oid, ".")
+		if !strings.HasPrefix(oid, prefix) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(oid, prefix), ".", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		column, err := strconv.Atoi(parts[0])
+		if err != nil {
+			continue
+		}
+		if table[parts[1]] == nil {
+			table[parts[1]] = map[int]string{}
+		}
+		table[parts[1]][column] = value
+	}
+	return table
+}
+
+// indexes returns the table's row indexes in order
+func (t mibTable) indexes() []string {
+	var indexes []string
+	for index := range t {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return compareOIDs(indexes[i], indexes[j]) < 0
+	})
+	return indexes
+}
+
+func (t mibTable) float(index string, column int) float64 {
+	v, _ := strconv.ParseFloat(strings.TrimSpace(t[index][column]), 64)
+	return v
+}
+
+func (t mibTable) int(index string, column int) int64 {
+	return int64(t.float(index, column))
+}
+
+// compareOIDs orders OIDs numerically by each component
+func compareOIDs(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		ai, _ := strconv.Atoi(as[i])
+		bi, _ := strconv.Atoi(bs[i])
+		if ai != bi {
+			return ai - bi
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// docsIfDownChannelModulation
+var downstreamModulations = map[int64]string{
+	1: "unknown",
+	2: "other",
+	3: "64QAM",
+	4: "256QAM",
+}
+
+// docsIfUpChannelType
+var upstreamChannelTypes = map[int64]string{
+	0: "unknown",
+	1: "TDMA",
+	2: "ATDMA",
+	3: "SCDMA",
+	4: "TDMA and ATDMA",
+}
+
+// rowsOf returns the rows of a table indexed by ifIndex and a second index,
+// such as a band or profile, grouped by ifIndex
+func (t mibTable) rowsOf(ifIndex string) []string {
+	var indexes []string
+	for _, index := range t.indexes() {
+		if strings.HasPrefix(index, ifIndex+".") {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+// FFT sizes by subcarrier spacing in kHz
+var (
+	downstreamFFTTypes = map[int64]string{50: "4K", 25: "8K"}
+	upstreamFFTTypes   = map[int64]string{50: "2K", 25: "4K"}
+)
+
+// decodeDocsIfMIB reads the DOCSIS channel tables out of a set of OID
+// values, as returned by an SNMP walk or a modem's OID keyed JSON. It fails
+// when none of the channel tables are there, as the values can't be from a
+// cable modem.
+func decodeDocsIfMIB(values map[string]string) (*docsis.Status, error) {
+	status := &docsis.Status{}
+
+	downstream := newMIBTable(values, oidDownstreamChannelEntry)
+	signalQuality := newMIBTable(values, oidSignalQualityEntry)
+	signalQualityExt := newMIBTable(values, oidSignalQualityExtEntry)
+	for _, index := range downstream.indexes() {
+		frequency := downstream.int(index, 2) // docsIfDownChannelFrequency
+		status.DSChannels = append(status.DSChannels, docsis.DSChannel{
+			ID:           downstream.int(index, 1), // docsIfDownChannelId
+			Frequency:    frequency,
+			Power:        downstream.float(index, 6) / 10,                 // docsIfDownChannelPower, TenthdBmV
+			Modulation:   downstreamModulations[downstream.int(index, 4)], // docsIfDownChannelModulation
+			SNR:          signalQuality.float(index, 5) / 10,              // docsIfSigQSignalNoise, TenthdB
+			Locked:       frequency > 0,                                   // Only locked channels are listed
+			RxMER:        signalQualityExt.float(index, 1) / 10,           // docsIf3SignalQualityExtRxMER, TenthdB
+			PreRSErrors:  signalQuality.float(index, 3),                   // docsIfSigQCorrecteds
+			PostRSErrors: signalQuality.float(index, 4),                   // docsIfSigQUncorrectables
+		})
+	}
+
+	upstream := newMIBTable(values, oidUpstreamChannelEntry)
+	cmStatusUs := newMIBTable(values, oidCmStatusUsEntry)
+	for _, index := range upstream.indexes() {
+		id := upstream.int(index, 1) // docsIfUpChannelId
+		if id == 0 {
+			continue
+		}
+		// docsIfUpChannelWidth is in Hz, with a roll off of 25%
+		symbolRate := upstream.float(index, 3) / 1.25 / 1000
+		status.USChannels = append(status.USChannels, docsis.USChannel{
+			ID:          id,
+			Frequency:   upstream.int(index, 2),          // docsIfUpChannelFrequency
+			Power:       cmStatusUs.float(index, 1) / 10, // docsIf3CmStatusUsTxPower, TenthdBmV
+			SymbolRate:  strconv.FormatFloat(symbolRate, 'f', -1, 64),
+			ChannelType: upstreamChannelTypes[upstream.int(index, 15)], // docsIfUpChannelType
+			T3Timeouts:  cmStatusUs.float(index, 2),                    // docsIf3CmStatusUsT3Timeouts
+			T4Timeouts:  cmStatusUs.float(index, 3),                    // docsIf3CmStatusUsT4Timeouts
+		})
+	}
+
+	ofdm := newMIBTable(values, oidCmDsOfdmChanEntry)
+	ofdmProfileStats := newMIBTable(values, oidCmDsOfdmProfileStatsEntry)
+	ofdmPower := newMIBTable(values, oidCmDsOfdmChannelPowerEntry)
+	for _, index := range ofdm.indexes() {
+		zeroFrequency := ofdm.int(index, 3) // docsIf31CmDsOfdmChanSubcarrierZeroFreq
+		firstActive := ofdm.int(index, 4)   // docsIf31CmDsOfdmChanFirstActiveSubcarrierNum
+		lastActive := ofdm.int(index, 5)    // docsIf31CmDsOfdmChanLastActiveSubcarrierNum
+		spacing := ofdm.int(index, 7)       // docsIf31CmDsOfdmChanSubcarrierSpacing, kHz
+		channel := docsis.DS31Channel{
+			ID:              ofdm.int(index, 1), // docsIf31CmDsOfdmChanChannelId
+			ChannelWidth:    float64((lastActive-firstActive+1)*spacing) / 1000,
+			FFTType:         downstreamFFTTypes[spacing],
+			Subcarriers:     ofdm.int(index, 6), // docsIf31CmDsOfdmChanNumActiveSubcarriers
+			FirstSubcarrier: zeroFrequency + firstActive*spacing*1000,
+			Locked:          zeroFrequency > 0, // Only locked channels are listed
+		}
+		// Codeword counts are kept per profile
+		for _, row := range ofdmProfileStats.rowsOf(index) {
+			channel.PreRSErrors += ofdmProfileStats.float(row, 4)  // docsIf31CmDsOfdmProfileStatsCorrectedCodewords
+			channel.PostRSErrors += ofdmProfileStats.float(row, 5) // docsIf31CmDsOfdmProfileStatsUncorrectableCodewords
+		}
+		// Power is kept per band, report the average
+		bands := ofdmPower.rowsOf(index)
+		for _, row := range bands {
+			channel.PLCPower += ofdmPower.float(row, 3) / 10 // docsIf31CmDsOfdmChannelPowerRxPower, TenthdBmV
+		}
+		if len(bands) > 0 {
+			channel.PLCPower /= float64(len(bands))
+		}
+		status.DS31Channels = append(status.DS31Channels, channel)
+	}
+
+	ofdma := newMIBTable(values, oidCmUsOfdmaChanEntry)
+	for _, index := range ofdma.indexes() {
+		spacing := ofdma.int(index, 7) // docsIf31CmUsOfdmaChanSubcarrierSpacing, kHz
+		status.US31Channels = append(status.US31Channels, docsis.US31Channel{
+			ID: ofdma.int(index, 1), // docsIf31CmUsOfdmaChanChannelId
+			// docsIf31CmUsOfdmaChanSubcarrierZeroFreq + docsIf31CmUsOfdmaChanFirstActiveSubcarrierNum
+			Frequency:   ofdma.int(index, 3) + ofdma.int(index, 4)*spacing*1000,
+			Power:       ofdma.float(index, 11) / 4, // docsIf31CmUsOfdmaChanTxPower, QuarterdBmV
+			FFTType:     upstreamFFTTypes[spacing],
+			ChannelType: "OFDMA",
+			T3Timeouts:  cmStatusUs.float(index, 2),
+			T4Timeouts:  cmStatusUs.float(index, 3),
+		})
+	}
+
+	status.Counts = docsis.ChannelCounts{
+		DS:   float64(len(status.DSChannels)),
+		US:   float64(len(status.USChannels)),
+		DS31: float64(len(status.DS31Channels)),
+		US31: float64(len(status.US31Channels)),
+	}
+	if len(status.DSChannels)+len(status.USChannels)+len(status.DS31Channels)+len(status.US31Channels) == 0 {
+		return nil, errors.New("no DOCSIS channel tables found")
+	}
+	return status, nil
+}
@@ -0,0 +1,81 @@
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"hub4_exporter/config"
+	"hub4_exporter/docsis"
+	"net/http"
+	"sort"
+)
+
+// Driver reads the status of a type of modem
+type Driver interface {
+	// Fetch reads the raw status from the modem, errors should be a
+	// FetchError so that they can be classified
+	Fetch(ctx context.Context, httpClient *http.Client, instance *config.InstancesConfig) ([]byte, error)
+	// Decode parses the raw status into the common model, the instance is
+	// passed for drivers whose layout is configurable
+	Decode(instance *config.InstancesConfig, data []byte) (*docsis.Status, error)
+}
+
+// Checker is implemented by drivers whose instances need settings of their
+// own, so that missing or invalid settings are found at startup
+type Checker interface {
+	Check(instance *config.InstancesConfig) error
+}
+
+// AutoType is the type of instances whose modem is detected, as are
+// instances without a type
+const AutoType = "auto"
+
+// IsAuto reports whether an instance's type is to be detected
+func IsAuto(name string) bool {
+	return name == "" || name == AutoType
+}
+
+var registry = map[string]Driver{}
+
+// Register makes a driver available under the given type
+func Register(name string, driver Driver) {
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("driver %s registered twice", name))
+	}
+	registry[name] = driver
+}
+
+// Get returns the driver for a type
+func Get(name string) (Driver, error) {
+	driver, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown modem type %q, expected one of %v", name, Types())
+	}
+	return driver, nil
+}
+
+// Check returns an error if the instance's type is unknown, or its settings
+// can't be used by the type's driver. Instances whose modem is detected
+// aren't checked.
+func Check(instance *config.InstancesConfig) error {
+	if IsAuto(instance.Type) {
+		return nil
+	}
+	driver, err := Get(instance.Type)
+	if err != nil {
+		return err
+	}
+	if checker, ok := driver.(Checker); ok {
+		return checker.Check(instance)
+	}
+	return nil
+}
+
+// Types returns the names of the registered drivers
+func Types() []string {
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,519 @@
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"golang.org/x/net/html"
+	"hub4_exporter/config"
+	"hub4_exporter/docsis"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("html", &HTML{})
+}
+
+// HTML reads retail modems which only publish their channel tables as an
+// HTML status page, the page and columns are set by the instance's html
+// settings
+type HTML struct{}
+
+// Built in layouts, by html model
+var htmlLayouts = map[string]config.HTMLConfig{
+	// Arris SB8200
+	"sb8200": {
+		Path: "/cmconnectionstatus.html",
+		Downstream: &config.HTMLTableConfig{
+			Title:      "Downstream Bonded Channels",
+			HeaderRows: 2,
+			Columns: map[string]int{
+				"channel_id":     0,
+				"lock_status":    1,
+				"modulation":     2,
+				"frequency":      3,
+				"power":          4,
+				"snr":            5,
+				"corrected":      6,
+				"uncorrectables": 7,
+			},
+		},
+		Upstream: &config.HTMLTableConfig{
+			Title:      "Upstream Bonded Channels",
+			HeaderRows: 2,
+			Columns: map[string]int{
+				"channel_id":   1,
+				"lock_status":  2,
+				"channel_type": 3,
+				"frequency":    4,
+				"width":        5,
+				"power":        6,
+			},
+		},
+	},
+	// Netgear CM-series, such as the CM1000, whose tables are empty in the
+	// page and filled in by JavaScript
+	"cm1000": {
+		Path: "/DocsisStatus.htm",
+		Downstream: &config.HTMLTableConfig{
+			Script: "InitDsTableTagValue",
+			Columns: map[string]int{
+				"lock_status":    1,
+				"modulation":     2,
+				"channel_id":     3,
+				"frequency":      4,
+				"power":          5,
+				"snr":            6,
+				"corrected":      7,
+				"uncorrectables": 8,
+			},
+		},
+		Upstream: &config.HTMLTableConfig{
+			Script: "InitUsTableTagValue",
+			Columns: map[string]int{
+				"lock_status":  1,
+				"channel_type": 2,
+				"channel_id":   3,
+				"symbol_rate":  4,
+				"frequency":    5,
+				"power":        6,
+			},
+		},
+		DownstreamOFDM: &config.HTMLTableConfig{
+			Script: "InitDsOfdmTableTagValue",
+			Columns: map[string]int{
+				"lock_status":      1,
+				"channel_id":       3,
+				"frequency":        4,
+				"power":            5,
+				"snr":              6,
+				"subcarrier_range": 7,
+				"corrected":        9,
+				"uncorrectables":   10,
+			},
+		},
+		UpstreamOFDMA: &config.HTMLTableConfig{
+			Script: "InitUsOfdmaTableTagValue",
+			Columns: map[string]int{
+				"lock_status": 1,
+				"channel_id":  3,
+				"frequency":   4,
+				"power":       5,
+			},
+		},
+	},
+}
+
+// htmlLayout returns the instance's layout, its model's built in layout with
+// any overrides applied
+func htmlLayout(instance *config.InstancesConfig) (*config.HTMLConfig, error) {
+	if instance.HTML == nil {
+		return nil, fmt.Errorf("instance %s has no html settings", instance.Name)
+	}
+	layout := config.HTMLConfig{}
+	if instance.HTML.Model != "" {
+		builtin, ok := htmlLayouts[strings.ToLower(instance.HTML.Model)]
+		if !ok {
+			return nil, fmt.Errorf("unknown html model %q", instance.HTML.Model)
+		}
+		layout = builtin
+	}
+	if instance.HTML.Path != "" {
+		layout.Path = instance.HTML.Path
+	}
+	if instance.HTML.Downstream != nil {
+		layout.Downstream = instance.HTML.Downstream
+	}
+	if instance.HTML.Upstream != nil {
+		layout.Upstream = instance.HTML.Upstream
+	}
+	if instance.HTML.DownstreamOFDM != nil {
+		layout.DownstreamOFDM = instance.HTML.DownstreamOFDM
+	}
+	if instance.HTML.UpstreamOFDMA != nil {
+		layout.UpstreamOFDMA = instance.HTML.UpstreamOFDMA
+	}
+	if layout.Path == "" || layout.Downstream == nil || layout.Upstream == nil {
+		return nil, fmt.Errorf("instance %s needs an html model or a path and both tables", instance.Name)
+	}
+	return &layout, nil
+}
+
+// Check checks the instance has a known html model, or a page and tables
+func (d *HTML) Check(instance *config.InstancesConfig) error {
+	_, err := htmlLayout(instance)
+	return err
+}
+
+func (d *HTML) Fetch(ctx context.Context, httpClient *http.Client, instance *config.InstancesConfig) ([]byte, error) {
+	layout, err := htmlLayout(instance)
+	if err != nil {
+		return nil, &FetchError{Reason: ReasonConnectionError, Err: err}
+	}
+	return httpGet(ctx, httpClient, fmt.Sprintf("http://%s%s", instance.Address, layout.Path))
+}
+
+func (d *HTML) Decode(instance *config.InstancesConfig, data []byte) (*docsis.Status, error) {
+	layout, err := htmlLayout(instance)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid status page: %s", err)
+	}
+
+	downstream, err := findHTMLTable(doc, data, layout.Downstream)
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := findHTMLTable(doc, data, layout.Upstream)
+	if err != nil {
+		return nil, err
+	}
+	downstreamOFDM, err := findHTMLTable(doc, data, layout.DownstreamOFDM)
+	if err != nil {
+		return nil, err
+	}
+	upstreamOFDMA, err := findHTMLTable(doc, data, layout.UpstreamOFDMA)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &docsis.Status{}
+	for _, row := range downstream.rows {
+		id, _ := parseHTMLNumber(row.get("channel_id"))
+		// Unused channels are listed with an ID of 0
+		if id == 0 {
+			continue
+		}
+		// OFDM channels may be listed with the SC-QAM channels
+		if isOFDM(row.get("modulation")) {
+			status.DS31Channels = append(status.DS31Channels, row.ds31Channel())
+			continue
+		}
+		power, _ := parseHTMLNumber(row.get("power"))
+		snr, _ := parseHTMLNumber(row.get("snr"))
+		corrected, _ := parseHTMLNumber(row.get("corrected"))
+		uncorrectables, _ := parseHTMLNumber(row.get("uncorrectables"))
+		status.DSChannels = append(status.DSChannels, docsis.DSChannel{
+			ID:           int64(id),
+			Frequency:    parseHTMLFrequency(row.get("frequency")),
+			Power:        power,
+			SNR:          snr,
+			Modulation:   row.get("modulation"),
+			Locked:       htmlLocked(row.get("lock_status")),
+			PreRSErrors:  corrected,
+			PostRSErrors: uncorrectables,
+		})
+	}
+	for _, row := range downstreamOFDM.rows {
+		if id, _ := parseHTMLNumber(row.get("channel_id")); id == 0 {
+			continue
+		}
+		status.DS31Channels = append(status.DS31Channels, row.ds31Channel())
+	}
+
+	for _, row := range upstream.rows {
+		id, _ := parseHTMLNumber(row.get("channel_id"))
+		// Unused channels are listed with an ID of 0
+		if id == 0 {
+			continue
+		}
+		if isOFDM(row.get("channel_type")) {
+			status.US31Channels = append(status.US31Channels, row.us31Channel())
+			continue
+		}
+		power, _ := parseHTMLNumber(row.get("power"))
+		symbolRate := ""
+		if rate, ok := parseHTMLNumber(row.get("symbol_rate")); ok {
+			symbolRate = strconv.FormatFloat(rate, 'f', -1, 64)
+		} else if width := parseHTMLFrequency(row.get("width")); width > 0 {
+			// Width in Hz, with a roll off of 25%
+			symbolRate = strconv.FormatFloat(float64(width)/1.25/1000, 'f', -1, 64)
+		}
+		status.USChannels = append(status.USChannels, docsis.USChannel{
+			ID:          int64(id),
+			Frequency:   parseHTMLFrequency(row.get("frequency")),
+			Power:       power,
+			SymbolRate:  symbolRate,
+			ChannelType: row.get("channel_type"),
+		})
+	}
+	for _, row := range upstreamOFDMA.rows {
+		if id, _ := parseHTMLNumber(row.get("channel_id")); id == 0 {
+			continue
+		}
+		status.US31Channels = append(status.US31Channels, row.us31Channel())
+	}
+
+	// Tables filled in by JavaScript are empty in the page, which shouldn't
+	// pass for a modem without channels
+	if len(status.DSChannels)+len(status.USChannels)+len(status.DS31Channels)+len(status.US31Channels) == 0 {
+		return nil, fmt.Errorf("invalid status page: no channels found")
+	}
+
+	status.Counts = docsis.ChannelCounts{
+		DS:   float64(len(status.DSChannels)),
+		US:   float64(len(status.USChannels)),
+		DS31: float64(len(status.DS31Channels)),
+		US31: float64(len(status.US31Channels)),
+	}
+	return status, nil
+}
+
+// htmlTable is a channel table with its columns named by the layout
+type htmlTable struct {
+	rows []htmlRow
+}
+
+type htmlRow struct {
+	cells   []string
+	columns map[string]int
+}
+
+// get returns the text of a named column, or "" if the layout doesn't have
+// it or the row is short
+func (r htmlRow) get(name string) string {
+	column, ok := r.columns[name]
+	if !ok || column < 0 || column >= len(r.cells) {
+		return ""
+	}
+	return r.cells[column]
+}
+
+// ds31Channel reads a DOCSIS 3.1 downstream channel. The pages give one
+// frequency for the channel but not its FFT type or width, so the range it
+// covers can't be worked out and FirstSubcarrier is left unset with them.
+func (r htmlRow) ds31Channel() docsis.DS31Channel {
+	id, _ := parseHTMLNumber(r.get("channel_id"))
+	power, _ := parseHTMLNumber(r.get("power"))
+	snr, _ := parseHTMLNumber(r.get("snr"))
+	corrected, _ := parseHTMLNumber(r.get("corrected"))
+	uncorrectables, _ := parseHTMLNumber(r.get("uncorrectables"))
+	return docsis.DS31Channel{
+		ID:           int64(id),
+		Subcarriers:  parseHTMLRangeSize(r.get("subcarrier_range")),
+		Modulation:   r.get("modulation"),
+		Locked:       htmlLocked(r.get("lock_status")),
+		PLCPower:     power,
+		RxMER:        snr,
+		PreRSErrors:  corrected,
+		PostRSErrors: uncorrectables,
+	}
+}
+
+// us31Channel reads a DOCSIS 3.1 upstream channel
+func (r htmlRow) us31Channel() docsis.US31Channel {
+	id, _ := parseHTMLNumber(r.get("channel_id"))
+	power, _ := parseHTMLNumber(r.get("power"))
+	channelType := r.get("channel_type")
+	if channelType == "" {
+		channelType = "OFDMA"
+	}
+	return docsis.US31Channel{
+		ID:          int64(id),
+		Frequency:   parseHTMLFrequency(r.get("frequency")),
+		Power:       power,
+		ChannelType: channelType,
+	}
+}
+
+// findHTMLTable finds the table described by conf, a table that isn't
+// configured has no rows
+func findHTMLTable(doc *html.Node, data []byte, conf *config.HTMLTableConfig) (*htmlTable, error) {
+	if conf == nil {
+		return &htmlTable{}, nil
+	}
+	if conf.Script != "" {
+		return findScriptTable(data, conf)
+	}
+
+	var found *html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if found != nil {
+			return
+		}
+		if n.Type == html.ElementNode && n.Data == "table" {
+			if conf.ID != "" && htmlAttr(n, "id") == conf.ID {
+				found = n
+				return
+			}
+			if conf.Title != "" {
+				rows := htmlTableRows(n)
+				if len(rows) > 0 && strings.Contains(strings.ToLower(strings.Join(rows[0], " ")), strings.ToLower(conf.Title)) {
+					found = n
+					return
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	if found == nil {
+		return nil, fmt.Errorf("invalid status page: table %s not found", conf.ID+conf.Title)
+	}
+
+	table := &htmlTable{}
+	for i, cells := range htmlTableRows(found) {
+		if i < conf.HeaderRows {
+			continue
+		}
+		table.rows = append(table.rows, htmlRow{cells: cells, columns: conf.Columns})
+	}
+	return table, nil
+}
+
+// htmlTableRows returns the text of each cell in each row of a table,
+// leaving out any nested tables
+func htmlTableRows(table *html.Node) [][]string {
+	var rows [][]string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.Data {
+			case "table":
+				// Nested table
+			case "tr":
+				var cells []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+						cells = append(cells, htmlText(cell))
+					}
+				}
+				rows = append(rows, cells)
+			default:
+				walk(c)
+			}
+		}
+	}
+	walk(table)
+	return rows
+}
+
+// findScriptTable reads a table from the tagValueList of a JavaScript
+// function, which holds the number of rows and then each row's cells, all
+// separated by |
+func findScriptTable(data []byte, conf *config.HTMLTableConfig) (*htmlTable, error) {
+	pattern := regexp.MustCompile(`(?s)function\s+` + regexp.QuoteMeta(conf.Script) + `\s*\(\s*\)\s*\{.*?tagValueList\s*=\s*['"]([^'"]*)['"]`)
+	match := pattern.FindSubmatch(data)
+	if match == nil {
+		return nil, fmt.Errorf("invalid status page: script %s not found", conf.Script)
+	}
+
+	values := strings.Split(strings.TrimSuffix(string(match[1]), "|"), "|")
+	count, err := strconv.Atoi(strings.TrimSpace(values[0]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid status page: script %s has no row count", conf.Script)
+	}
+	table := &htmlTable{}
+	if count <= 0 {
+		return table, nil
+	}
+	values = values[1:]
+	if len(values)%count != 0 {
+		return nil, fmt.Errorf("invalid status page: script %s has %d values for %d rows", conf.Script, len(values), count)
+	}
+	width := len(values) / count
+	for i := 0; i < count; i++ {
+		var cells []string
+		for _, value := range values[i*width : (i+1)*width] {
+			cells = append(cells, strings.TrimSpace(value))
+		}
+		table.rows = append(table.rows, htmlRow{cells: cells, columns: conf.Columns})
+	}
+	return table, nil
+}
+
+func htmlText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func htmlAttr(n *html.Node, name string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+var htmlNumber = regexp.MustCompile(`^\s*(-?[0-9]*\.?[0-9]+)\s*([A-Za-z]*)`)
+
+// parseHTMLNumber reads the number at the start of a cell, ignoring any unit
+func parseHTMLNumber(s string) (float64, bool) {
+	match := htmlNumber.FindStringSubmatch(s)
+	if match == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(match[1], 64)
+	return v, err == nil
+}
+
+// parseHTMLFrequency reads a frequency in Hz, kHz, MHz or GHz, returning Hz
+func parseHTMLFrequency(s string) int64 {
+	match := htmlNumber.FindStringSubmatch(s)
+	if match == nil {
+		return 0
+	}
+	v, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0
+	}
+	switch strings.ToLower(match[2]) {
+	case "khz":
+		v *= 1000
+	case "mhz":
+		v *= 1000000
+	case "ghz":
+		v *= 1000000000
+	}
+	return int64(v)
+}
+
+var htmlRange = regexp.MustCompile(`^\s*([0-9]+)\s*~\s*([0-9]+)`)
+
+// parseHTMLRangeSize reads the size of a range such as "148 ~ 3947"
+func parseHTMLRangeSize(s string) int64 {
+	match := htmlRange.FindStringSubmatch(s)
+	if match == nil {
+		return 0
+	}
+	first, _ := strconv.ParseInt(match[1], 10, 64)
+	last, _ := strconv.ParseInt(match[2], 10, 64)
+	if last < first {
+		return 0
+	}
+	return last - first + 1
+}
+
+func htmlLocked(status string) bool {
+	return strings.EqualFold(strings.TrimSpace(status), "Locked")
+}
+
+// isOFDM reports whether a modulation or channel type is for a DOCSIS 3.1
+// channel, which retail modems show as Other, OFDM or OFDMA
+func isOFDM(s string) bool {
+	s = strings.ToLower(s)
+	return s == "other" || strings.Contains(s, "ofdm")
+}
@@ -0,0 +1,168 @@
+package drivers
+
+import (
+	"hub4_exporter/config"
+	"testing"
+)
+
+func htmlInstance(t *testing.T, path string, file string, conf *config.HTMLConfig) *config.InstancesConfig {
+	server := newFixtureServer(t, map[string]string{path: file})
+	instance := testInstance(server)
+	instance.Type = "html"
+	instance.HTML = conf
+	return instance
+}
+
+func TestHTMLSB8200(t *testing.T) {
+	instance := htmlInstance(t, "/cmconnectionstatus.html", "sb8200_cmconnectionstatus.html", &config.HTMLConfig{Model: "sb8200"})
+
+	data, err := fetch(t, &HTML{}, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := (&HTML{}).Decode(instance, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status.DSChannels) != 2 {
+		t.Fatalf("got %d DS channels, want 2", len(status.DSChannels))
+	}
+	ds := status.DSChannels[0]
+	if ds.ID != 21 || ds.Frequency != 483000000 || ds.Power != 5.2 || ds.SNR != 42.1 || ds.Modulation != "QAM256" || !ds.Locked || ds.PreRSErrors != 15 || ds.PostRSErrors != 3 {
+		t.Errorf("got DS channel %+v", ds)
+	}
+	if status.DSChannels[1].Power != -0.8 {
+		t.Errorf("got DS power %v, want -0.8", status.DSChannels[1].Power)
+	}
+
+	// The OFDM channel is listed with the SC-QAM channels
+	if len(status.DS31Channels) != 1 {
+		t.Fatalf("got %d DS 3.1 channels, want 1", len(status.DS31Channels))
+	}
+	ds31 := status.DS31Channels[0]
+	if ds31.ID != 159 || ds31.PLCPower != 4.6 || ds31.RxMER != 40.4 || ds31.PreRSErrors != 84291 {
+		t.Errorf("got DS 3.1 channel %+v", ds31)
+	}
+	if ds31.ChannelWidth != 0 || ds31.FFTType != "" {
+		t.Errorf("got DS 3.1 width %v and FFT type %q, want them unset", ds31.ChannelWidth, ds31.FFTType)
+	}
+	if start, end := ds31.FrequencyRange(); start != 0 || end != 0 {
+		t.Errorf("got frequency range %d-%d, want it unset", start, end)
+	}
+
+	// The unused channel is left out
+	if len(status.USChannels) != 2 {
+		t.Fatalf("got %d US channels, want 2", len(status.USChannels))
+	}
+	us := status.USChannels[0]
+	if us.ID != 2 || us.Frequency != 23700000 || us.Power != 45 || us.SymbolRate != "5120" || us.ChannelType != "SC-QAM Upstream" {
+		t.Errorf("got US channel %+v", us)
+	}
+	if len(status.US31Channels) != 1 || status.US31Channels[0].Frequency != 36200000 || status.US31Channels[0].Power != 39.5 {
+		t.Errorf("got US 3.1 channels %+v", status.US31Channels)
+	}
+}
+
+func TestHTMLCM1000(t *testing.T) {
+	instance := htmlInstance(t, "/DocsisStatus.htm", "cm1000_docsisstatus.htm", &config.HTMLConfig{Model: "cm1000"})
+
+	data, err := fetch(t, &HTML{}, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := (&HTML{}).Decode(instance, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The tables are read from the page's JavaScript, unused channels are
+	// left out
+	if len(status.DSChannels) != 2 {
+		t.Fatalf("got %d DS channels, want 2", len(status.DSChannels))
+	}
+	ds := status.DSChannels[1]
+	if ds.ID != 18 || ds.Frequency != 561000000 || ds.Power != 3.4 || ds.SNR != 41.5 || ds.Modulation != "QAM256" || !ds.Locked || ds.PreRSErrors != 3 || ds.PostRSErrors != 1 {
+		t.Errorf("got DS channel %+v", ds)
+	}
+
+	if len(status.USChannels) != 2 {
+		t.Fatalf("got %d US channels, want 2", len(status.USChannels))
+	}
+	us := status.USChannels[0]
+	if us.ID != 1 || us.Frequency != 36500000 || us.Power != 44.3 || us.SymbolRate != "5120" || us.ChannelType != "ATDMA" {
+		t.Errorf("got US channel %+v", us)
+	}
+
+	if len(status.DS31Channels) != 1 {
+		t.Fatalf("got %d DS 3.1 channels, want 1", len(status.DS31Channels))
+	}
+	ds31 := status.DS31Channels[0]
+	if ds31.ID != 33 || ds31.Subcarriers != 3800 || ds31.PLCPower != -1.2 || ds31.RxMER != 41.5 || ds31.PreRSErrors != 100 || ds31.PostRSErrors != 2 {
+		t.Errorf("got DS 3.1 channel %+v", ds31)
+	}
+	if start, end := ds31.FrequencyRange(); start != 0 || end != 0 {
+		t.Errorf("got frequency range %d-%d, want it unset", start, end)
+	}
+
+	if len(status.US31Channels) != 1 {
+		t.Fatalf("got %d US 3.1 channels, want 1", len(status.US31Channels))
+	}
+	us31 := status.US31Channels[0]
+	if us31.ID != 41 || us31.Frequency != 29800000 || us31.Power != 42 || us31.ChannelType != "OFDMA" {
+		t.Errorf("got US 3.1 channel %+v", us31)
+	}
+}
+
+func TestHTMLEmptyTables(t *testing.T) {
+	// Reading the CM1000's tables from the page finds them empty
+	instance := htmlInstance(t, "/DocsisStatus.htm", "cm1000_docsisstatus.htm", &config.HTMLConfig{
+		Path:       "/DocsisStatus.htm",
+		Downstream: &config.HTMLTableConfig{ID: "dsTable", HeaderRows: 1, Columns: map[string]int{"channel_id": 3}},
+		Upstream:   &config.HTMLTableConfig{ID: "usTable", HeaderRows: 1, Columns: map[string]int{"channel_id": 3}},
+	})
+
+	data, err := fetch(t, &HTML{}, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&HTML{}).Decode(instance, data); err == nil {
+		t.Error("got no error decoding empty tables")
+	}
+}
+
+func TestHTMLWrongPage(t *testing.T) {
+	// The SB8200 page doesn't have the CM1000's scripts
+	instance := htmlInstance(t, "/DocsisStatus.htm", "sb8200_cmconnectionstatus.html", &config.HTMLConfig{Model: "cm1000"})
+
+	data, err := fetch(t, &HTML{}, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&HTML{}).Decode(instance, data); err == nil {
+		t.Error("got no error decoding the wrong page")
+	}
+}
+
+func TestHTMLCheck(t *testing.T) {
+	table := &config.HTMLTableConfig{Title: "Downstream"}
+	for _, test := range []struct {
+		name string
+		conf *config.HTMLConfig
+		ok   bool
+	}{
+		{"model", &config.HTMLConfig{Model: "SB8200"}, true},
+		{"page and tables", &config.HTMLConfig{Path: "/status.html", Downstream: table, Upstream: table}, true},
+		{"no settings", nil, false},
+		{"unknown model", &config.HTMLConfig{Model: "sb6183"}, false},
+		{"no upstream table", &config.HTMLConfig{Path: "/status.html", Downstream: table}, false},
+	} {
+		instance := &config.InstancesConfig{Name: "test", Type: "html", HTML: test.conf}
+		if err := Check(instance); (err == nil) != test.ok {
+			t.Errorf("%s: got error %v, want ok %t", test.name, err, test.ok)
+		}
+	}
+	if err := Check(&config.InstancesConfig{Name: "test", Type: "hub9"}); err == nil {
+		t.Error("unknown type: got no error")
+	}
+}
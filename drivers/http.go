@@ -0,0 +1,109 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// Reasons used for the reason label of hub4_scrape_errors_total
+const (
+	ReasonTimeout           = "timeout"
+	ReasonConnectionRefused = "connection_refused"
+	ReasonConnectionError   = "connection_error"
+	ReasonHTTPStatus        = "http_status"
+	ReasonReadError         = "read_error"
+	ReasonParseError        = "parse_error"
+	// Set by the exporter while the instance's circuit breaker is open
+	ReasonCircuitOpen = "circuit_open"
+)
+
+// Reasons lists every reason a scrape can fail with
+var Reasons = []string{
+	ReasonTimeout,
+	ReasonConnectionRefused,
+	ReasonConnectionError,
+	ReasonHTTPStatus,
+	ReasonReadError,
+	ReasonParseError,
+	ReasonCircuitOpen,
+}
+
+// FetchError is returned when fetching from an instance fails, Reason
+// classifies the failure for hub4_scrape_errors_total
+type FetchError struct {
+	Reason string
+	Err    error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorReason returns the reason a fetch failed, errors that aren't a
+// FetchError are classified as connection errors
+func ErrorReason(err error) string {
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr.Reason
+	}
+	return ReasonConnectionError
+}
+
+// httpGet gets url, returning the body of a 200 response
+func httpGet(ctx context.Context, httpClient *http.Client, url string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, &FetchError{Reason: ReasonConnectionError, Err: err}
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, &FetchError{Reason: classifyRequestError(err), Err: err}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, &FetchError{Reason: ReasonHTTPStatus, Err: fmt.Errorf("unexpected HTTP status %s", response.Status)}
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, &FetchError{Reason: classifyReadError(err), Err: err}
+	}
+	return body, nil
+}
+
+// classifyRequestError maps an error from making a request to a reason
+func classifyRequestError(err error) string {
+	if isTimeout(err) {
+		return ReasonTimeout
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ReasonConnectionRefused
+	}
+	return ReasonConnectionError
+}
+
+// classifyReadError maps an error from reading a response body to a reason
+func classifyReadError(err error) string {
+	if isTimeout(err) {
+		return ReasonTimeout
+	}
+	return ReasonReadError
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,40 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"hub4_exporter/config"
+	"hub4_exporter/docsis"
+	"net/http"
+)
+
+func init() {
+	Register("hub3", &Hub3{})
+}
+
+// Hub3 reads the Virgin Media Hub 3 (Arris TG2492), which publishes the
+// DOCSIS MIB tables as a JSON object keyed by OID
+type Hub3 struct{}
+
+func (d *Hub3) Fetch(ctx context.Context, httpClient *http.Client, instance *config.InstancesConfig) ([]byte, error) {
+	return httpGet(ctx, httpClient, fmt.Sprintf("http://%s/getRouterStatus", instance.Address))
+}
+
+func (d *Hub3) Decode(instance *config.InstancesConfig, data []byte) (*docsis.Status, error) {
+	if !gjson.ValidBytes(data) {
+		return nil, errors.New("invalid router status: not valid JSON")
+	}
+	root := gjson.ParseBytes(data)
+	if !root.IsObject() {
+		return nil, errors.New("invalid router status: not a JSON object")
+	}
+
+	values := map[string]string{}
+	root.ForEach(func(key, value gjson.Result) bool {
+		values[key.String()] = value.String()
+		return true
+	})
+	return decodeDocsIfMIB(values)
+}
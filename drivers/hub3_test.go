@@ -0,0 +1,102 @@
+package drivers
+
+import (
+	"context"
+	"hub4_exporter/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newFixtureServer serves each path's file from testdata, other paths are
+// not found
+func newFixtureServer(t *testing.T, files map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		data, err := ioutil.ReadFile("testdata/" + file)
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testInstance returns an instance for the address of a test server
+func testInstance(server *httptest.Server) *config.InstancesConfig {
+	return &config.InstancesConfig{
+		Name:    "test",
+		Address: strings.TrimPrefix(server.URL, "http://"),
+	}
+}
+
+// fetch reads an instance's raw status through a driver
+func fetch(t *testing.T, driver Driver, instance *config.InstancesConfig) ([]byte, error) {
+	t.Helper()
+	return driver.Fetch(context.Background(), http.DefaultClient, instance)
+}
+
+func TestHub3(t *testing.T) {
+	server := newFixtureServer(t, map[string]string{"/getRouterStatus": "hub3_routerstatus.json"})
+	instance := testInstance(server)
+
+	data, err := fetch(t, &Hub3{}, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := (&Hub3{}).Decode(instance, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status.DSChannels) != 2 {
+		t.Fatalf("got %d DS channels, want 2", len(status.DSChannels))
+	}
+	channel := status.DSChannels[0]
+	if channel.ID != 25 || channel.Frequency != 331000000 || channel.Power != 3.5 || channel.SNR != 40.3 || channel.Modulation != "256QAM" || !channel.Locked {
+		t.Errorf("got DS channel %+v", channel)
+	}
+	if channel.PreRSErrors != 10 || channel.PostRSErrors != 2 {
+		t.Errorf("got RS errors %v/%v, want 10/2", channel.PreRSErrors, channel.PostRSErrors)
+	}
+	if status.DSChannels[1].Power != -1.2 {
+		t.Errorf("got DS power %v, want -1.2", status.DSChannels[1].Power)
+	}
+
+	if len(status.USChannels) != 1 {
+		t.Fatalf("got %d US channels, want 1", len(status.USChannels))
+	}
+	us := status.USChannels[0]
+	if us.ID != 1 || us.Frequency != 49600000 || us.Power != 44.5 || us.SymbolRate != "5120" || us.ChannelType != "ATDMA" || us.T3Timeouts != 3 {
+		t.Errorf("got US channel %+v", us)
+	}
+	if status.Counts.DS != 2 || status.Counts.US != 1 {
+		t.Errorf("got counts %+v", status.Counts)
+	}
+}
+
+func TestHub3DecodeInvalid(t *testing.T) {
+	// An object without the DOCSIS tables isn't from a Hub 3
+	for _, data := range []string{`not json`, `[]`, `{}`, `{"1":"Finish"}`} {
+		if _, err := (&Hub3{}).Decode(&config.InstancesConfig{Name: "test"}, []byte(data)); err == nil {
+			t.Errorf("decoding %q: got no error", data)
+		}
+	}
+}
+
+func TestHub3FetchHTTPStatus(t *testing.T) {
+	server := newFixtureServer(t, nil)
+	_, err := fetch(t, &Hub3{}, testInstance(server))
+	if reason := ErrorReason(err); reason != ReasonHTTPStatus {
+		t.Errorf("got reason %q, want %q", reason, ReasonHTTPStatus)
+	}
+}
@@ -0,0 +1,119 @@
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"hub4_exporter/config"
+	"hub4_exporter/docsis"
+	"hub4_exporter/hub4"
+	"net/http"
+)
+
+func init() {
+	Register("hub4", &Hub4{})
+}
+
+// Hub4 reads the Virgin Media Hub 4's unauthenticated network status
+type Hub4 struct{}
+
+func (d *Hub4) Fetch(ctx context.Context, httpClient *http.Client, instance *config.InstancesConfig) ([]byte, error) {
+	return httpGet(ctx, httpClient, fmt.Sprintf("http://%s/php/ajaxGet_device_networkstatus_data.php", instance.Address))
+}
+
+func (d *Hub4) Decode(instance *config.InstancesConfig, data []byte) (*docsis.Status, error) {
+	networkStatus, err := hub4.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &docsis.Status{
+		Modem: &docsis.Modem{
+			AcquiredDSChannel:       networkStatus.AcquiredDSChannel,
+			RangedUSChannel:         networkStatus.RangedUSChannel,
+			AcquiredDSChannelStatus: networkStatus.AcquiredDSChannelStatus,
+			RangedUSChannelStatus:   networkStatus.RangedUSChannelStatus,
+			ProvisioningState:       networkStatus.ProvisioningState,
+			NetworkAccess:           networkStatus.NetworkAccess,
+			MaxCPE:                  networkStatus.MaxCPE,
+			BPIState:                networkStatus.BPIState,
+			DOCSISVersion:           networkStatus.DOCSISVersion,
+			BootFile:                networkStatus.BootFile,
+			SchedulingType:          networkStatus.SchedulingType,
+			PrimaryChannelType:      networkStatus.PrimaryChannelType,
+		},
+		ServiceFlows: &docsis.ServiceFlows{
+			DSFlowID:               networkStatus.DSFlowID,
+			DSMaxTrafficRate:       networkStatus.DSMaxTrafficRate,
+			DSMaxTrafficBurst:      networkStatus.DSMaxTrafficBurst,
+			DSMinTrafficRate:       networkStatus.DSMinTrafficRate,
+			USFlowID:               networkStatus.USFlowID,
+			USMaxTrafficRate:       networkStatus.USMaxTrafficRate,
+			USMaxTrafficBurst:      networkStatus.USMaxTrafficBurst,
+			USMinTrafficRate:       networkStatus.USMinTrafficRate,
+			USMaxConcatenatedBurst: networkStatus.USMaxConcatenatedBurst,
+		},
+		Counts: docsis.ChannelCounts{
+			DS:   networkStatus.DSChannelCount,
+			US:   networkStatus.USChannelCount,
+			DS31: networkStatus.DS31ChannelCount,
+			US31: networkStatus.US31ChannelCount,
+		},
+	}
+
+	for _, channel := range networkStatus.DSChannels {
+		status.DSChannels = append(status.DSChannels, docsis.DSChannel{
+			ID:           channel.ID,
+			Frequency:    channel.Frequency,
+			Power:        channel.Power,
+			SNR:          channel.SNR,
+			Modulation:   channel.Modulation,
+			Locked:       channel.LockStatus == "Locked",
+			RxMER:        channel.RxMER,
+			PreRSErrors:  channel.PreRSErrors,
+			PostRSErrors: channel.PostRSErrors,
+		})
+	}
+	for _, channel := range networkStatus.USChannels {
+		// Unused channels have an ID of 0
+		if channel.ID == 0 {
+			continue
+		}
+		status.USChannels = append(status.USChannels, docsis.USChannel(channel))
+	}
+	for _, channel := range networkStatus.DS31Channels {
+		status.DS31Channels = append(status.DS31Channels, docsis.DS31Channel{
+			ID:              channel.ID,
+			ChannelWidth:    channel.ChannelWidth,
+			FFTType:         channel.FFTType,
+			Subcarriers:     channel.Subcarriers,
+			Modulation:      channel.Modulation,
+			FirstSubcarrier: channel.FirstSubcarrier,
+			Locked:          channel.LockStatus == "Locked",
+			RxMER:           channel.RxMER,
+			PLCPower:        channel.PLCPower,
+			PreRSErrors:     channel.PreRSErrors,
+			PostRSErrors:    channel.PostRSErrors,
+		})
+	}
+	for _, channel := range networkStatus.US31Channels {
+		// Unused channels have an ID of 0
+		if channel.ID == 0 {
+			continue
+		}
+		// OFDMA channels have no symbol rate, the Hub 4 sends the FFT type
+		// in its place
+		status.US31Channels = append(status.US31Channels, docsis.US31Channel{
+			ID:          channel.ID,
+			Frequency:   channel.Frequency,
+			Power:       channel.Power,
+			FFTType:     channel.SymbolRate,
+			Modulation:  channel.Modulation,
+			ChannelType: channel.ChannelType,
+			T1Timeouts:  channel.T1Timeouts,
+			T2Timeouts:  channel.T2Timeouts,
+			T3Timeouts:  channel.T3Timeouts,
+			T4Timeouts:  channel.T4Timeouts,
+		})
+	}
+	return status, nil
+}
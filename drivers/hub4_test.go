@@ -0,0 +1,63 @@
+package drivers
+
+import (
+	"hub4_exporter/config"
+	"io/ioutil"
+	"testing"
+)
+
+func TestHub4DecodeRecordedResponse(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/hub4_networkstatus.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := (&Hub4{}).Decode(&config.InstancesConfig{Name: "test"}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status.DSChannels) != 8 {
+		t.Fatalf("got %d DS channels, want 8", len(status.DSChannels))
+	}
+	if ds := status.DSChannels[5]; ds.SNR != 37.6 || ds.RxMER != 38.983 {
+		t.Errorf("got SNR %v and RxMER %v, want 37.6 and 38.983", ds.SNR, ds.RxMER)
+	}
+	// The unused channels with an ID of 0 are dropped
+	if len(status.USChannels) != 4 {
+		t.Errorf("got %d US channels, want 4", len(status.USChannels))
+	}
+	if len(status.DS31Channels) != 1 {
+		t.Fatalf("got %d DS 3.1 channels, want 1", len(status.DS31Channels))
+	}
+
+	channel := status.DS31Channels[0]
+	if channel.RxMER != 41.5 {
+		t.Errorf("got RxMER %v, want 41.5", channel.RxMER)
+	}
+	if channel.PLCPower != -1.2 {
+		t.Errorf("got PLC power %v, want -1.2", channel.PLCPower)
+	}
+	if !channel.Locked {
+		t.Error("got unlocked DS 3.1 channel, want locked")
+	}
+	start, end := channel.FrequencyRange()
+	if start != 148000000 || end != 242000000 {
+		t.Errorf("got frequency range %d-%d, want 148000000-242000000", start, end)
+	}
+
+	// The FFT type of OFDMA channels is sent in the symbol rate column
+	if len(status.US31Channels) != 1 {
+		t.Fatalf("got %d US 3.1 channels, want 1", len(status.US31Channels))
+	}
+	if us31 := status.US31Channels[0]; us31.FFTType != "2K" {
+		t.Errorf("got FFT type %q, want 2K", us31.FFTType)
+	}
+}
+
+func TestHub4DecodeInvalid(t *testing.T) {
+	for _, data := range []string{``, `{}`, `["330000000"]`} {
+		if _, err := (&Hub4{}).Decode(&config.InstancesConfig{Name: "test"}, []byte(data)); err == nil {
+			t.Errorf("decoding %q: got no error", data)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package drivers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hub4_exporter/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The Hub 4 login form posts here, setting the session cookie on success
+const hub4LoginPath = "/php/ajaxSet_Password.php"
+
+// How long to wait before logging in again after the modem rejects a login,
+// doubling after each rejection so as not to lock the account out
+const (
+	hub4LoginBackoff    = time.Minute
+	hub4MaxLoginBackoff = time.Minute * 30
+)
+
+var errSessionExpired = errors.New("session expired")
+
+// ErrPageNotFound is returned by Hub4Session.Get when the modem doesn't have
+// the page, which it either answers with 404 or a redirect to another page
+var ErrPageNotFound = errors.New("page not found")
+
+// LoginError is returned when the modem rejects a login, either with a
+// status other than a matching password or by not setting a session cookie
+type LoginError struct {
+	Err error
+}
+
+func (e *LoginError) Error() string {
+	return fmt.Sprintf("login failed: %s", e.Err)
+}
+
+func (e *LoginError) Unwrap() error {
+	return e.Err
+}
+
+// Hub4Session is a logged in session with a Hub 4's admin web UI. The
+// session cookie is kept between requests, and the session logged in again
+// when it expires. After the modem rejects a login no other is tried until
+// a backoff has passed.
+type Hub4Session struct {
+	mutex       sync.Mutex
+	client      *http.Client
+	address     string
+	credentials *config.CredentialsConfig
+	loggedIn    bool
+	// Counts the logins, so that requests that found the session expired
+	// only log in again if no other request already has
+	generation int
+	rejected   error
+	retryAt    time.Time
+	backoff    time.Duration
+}
+
+// NewHub4Session returns a session for the instance, sharing the transport
+// of httpClient. It logs in on first use.
+func NewHub4Session(httpClient *http.Client, instance *config.InstancesConfig) (*Hub4Session, error) {
+	if instance.Credentials == nil {
+		return nil, fmt.Errorf("instance %s has no credentials", instance.Name)
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Hub4Session{
+		client: &http.Client{
+			Transport: httpClient.Transport,
+			Jar:       jar,
+		},
+		address:     instance.Address,
+		credentials: instance.Credentials,
+	}, nil
+}
+
+// notExpired is passed to login when no session has been found expired
+const notExpired = -1
+
+// Login logs in unless the session is already logged in
+func (s *Hub4Session) Login(ctx context.Context) error {
+	_, err := s.login(ctx, notExpired)
+	return err
+}
+
+// Get gets a page of the admin web UI, logging in first if needed
+func (s *Hub4Session) Get(ctx context.Context, path string) ([]byte, error) {
+	generation, err := s.login(ctx, notExpired)
+	if err != nil {
+		return nil, err
+	}
+	body, err := s.get(ctx, path)
+	if errors.Is(err, errSessionExpired) {
+		if _, err := s.login(ctx, generation); err != nil {
+			return nil, err
+		}
+		body, err = s.get(ctx, path)
+	}
+	return body, err
+}
+
+// login logs in unless already logged in, returning the generation of the
+// session. A session found expired is logged in again, unless another
+// request has already logged in since that session's login.
+func (s *Hub4Session) login(ctx context.Context, expired int) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if expired == s.generation {
+		s.loggedIn = false
+	}
+	if s.loggedIn {
+		return s.generation, nil
+	}
+	if s.rejected != nil && time.Now().Before(s.retryAt) {
+		return 0, fmt.Errorf("not logging in again until %s: %s", s.retryAt.Format(time.RFC3339), s.rejected)
+	}
+
+	password, err := s.credentials.LoadPassword()
+	if err != nil {
+		return 0, err
+	}
+	username := s.credentials.Username
+	if username == "" {
+		username = "admin"
+	}
+	form := url.Values{"username": {username}, "password": {password}}
+
+	loginURL := fmt.Sprintf("http://%s%s", s.address, hub4LoginPath)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, loginURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, &FetchError{Reason: ReasonConnectionError, Err: err}
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := s.client.Do(request)
+	if err != nil {
+		return 0, &FetchError{Reason: classifyRequestError(err), Err: err}
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return 0, &FetchError{Reason: ReasonHTTPStatus, Err: fmt.Errorf("unexpected HTTP status %s", response.Status)}
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return 0, &FetchError{Reason: classifyReadError(err), Err: err}
+	}
+
+	// The response says if the password was wrong or the account is locked
+	// out, only a matching password gets a session cookie
+	var result struct {
+		Status string `json:"p_status"`
+	}
+	if json.Unmarshal(body, &result) == nil && result.Status != "" && result.Status != "Match" {
+		return 0, s.reject(fmt.Errorf("modem replied %s", result.Status))
+	}
+	// The jar still has the cookie of an expired session, so look for one
+	// set by this login
+	if !hasSessionCookie(response) {
+		return 0, s.reject(errors.New("no session cookie"))
+	}
+	s.loggedIn = true
+	s.generation++
+	s.rejected = nil
+	s.backoff = 0
+	return s.generation, nil
+}
+
+// hasSessionCookie reports whether a login response sets a cookie
+func hasSessionCookie(response *http.Response) bool {
+	for _, cookie := range response.Cookies() {
+		if cookie.Value != "" && cookie.MaxAge >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// reject records a rejected login, doubling the time until the next
+func (s *Hub4Session) reject(err error) error {
+	s.backoff *= 2
+	if s.backoff == 0 {
+		s.backoff = hub4LoginBackoff
+	}
+	if s.backoff > hub4MaxLoginBackoff {
+		s.backoff = hub4MaxLoginBackoff
+	}
+	s.rejected = &LoginError{Err: err}
+	s.retryAt = time.Now().Add(s.backoff)
+	return s.rejected
+}
+
+// get gets a page with the session cookie. An unauthorised status or a
+// redirect to the login page means the session has expired, a redirect
+// anywhere else that the modem doesn't have the page.
+func (s *Hub4Session) get(ctx context.Context, path string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s", s.address, path), nil)
+	if err != nil {
+		return nil, &FetchError{Reason: ReasonConnectionError, Err: err}
+	}
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, &FetchError{Reason: classifyRequestError(err), Err: err}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden {
+		return nil, errSessionExpired
+	}
+	if response.Request.URL.Path != request.URL.Path {
+		if isHub4LoginPage(response.Request.URL) {
+			return nil, errSessionExpired
+		}
+		return nil, &FetchError{Reason: ReasonHTTPStatus, Err: fmt.Errorf("%w: redirected to %s", ErrPageNotFound, response.Request.URL.Path)}
+	}
+	if response.StatusCode == http.StatusNotFound {
+		return nil, &FetchError{Reason: ReasonHTTPStatus, Err: ErrPageNotFound}
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, &FetchError{Reason: ReasonHTTPStatus, Err: fmt.Errorf("unexpected HTTP status %s", response.Status)}
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, &FetchError{Reason: classifyReadError(err), Err: err}
+	}
+	return body, nil
+}
+
+// isHub4LoginPage reports whether a redirect went to the login page, which
+// is the root page or one naming the login
+func isHub4LoginPage(u *url.URL) bool {
+	if u.Path == "/" || u.Path == "" || u.Path == "/index.php" {
+		return true
+	}
+	return strings.Contains(strings.ToLower(u.Path), "login")
+}
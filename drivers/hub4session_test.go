@@ -0,0 +1,211 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"hub4_exporter/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// hub4LoginServer is a Hub 4 admin web UI that accepts one password, pages
+// without a valid session redirect to the login page
+type hub4LoginServer struct {
+	*httptest.Server
+	mutex   sync.Mutex
+	logins  int
+	session string
+	// Accept the password without setting a session cookie
+	noCookie bool
+}
+
+func newHub4LoginServer(t *testing.T) *hub4LoginServer {
+	s := &hub4LoginServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *hub4LoginServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch r.URL.Path {
+	case hub4LoginPath:
+		s.logins++
+		if r.PostFormValue("username") != "admin" || r.PostFormValue("password") != "secret" {
+			w.Write([]byte(`{"p_status":"Lockout"}`))
+			return
+		}
+		if s.noCookie {
+			w.Write([]byte(`{"p_status":"Match"}`))
+			return
+		}
+		s.session = strings.Repeat("a", s.logins)
+		http.SetCookie(w, &http.Cookie{Name: "credential", Value: s.session, Path: "/"})
+		w.Write([]byte(`{"p_status":"Match"}`))
+	case "/", "/home.php":
+		w.Write([]byte("<html></html>"))
+	default:
+		cookie, err := r.Cookie("credential")
+		if err != nil || s.session == "" || cookie.Value != s.session {
+			http.Redirect(w, r, "/?login", http.StatusFound)
+			return
+		}
+		if r.URL.Path == "/php/moved.php" {
+			http.Redirect(w, r, "/home.php", http.StatusFound)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}
+}
+
+// expire ends the session on the modem's side
+func (s *hub4LoginServer) expire() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.session = ""
+}
+
+func (s *hub4LoginServer) loginCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.logins
+}
+
+func newTestHub4Session(t *testing.T, server *httptest.Server, password string) *Hub4Session {
+	instance := testInstance(server)
+	instance.Credentials = &config.CredentialsConfig{Password: password}
+	session, err := NewHub4Session(http.DefaultClient, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestHub4SessionExpired(t *testing.T) {
+	server := newHub4LoginServer(t)
+	session := newTestHub4Session(t, server.Server, "secret")
+
+	for i := 0; i < 2; i++ {
+		body, err := session.Get(context.Background(), "/php/page.php")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != `{"ok":true}` {
+			t.Errorf("got %q", body)
+		}
+	}
+	if logins := server.loginCount(); logins != 1 {
+		t.Errorf("logged in %d times, want 1", logins)
+	}
+
+	// A redirect to the login page logs in again
+	server.expire()
+	if _, err := session.Get(context.Background(), "/php/page.php"); err != nil {
+		t.Fatal(err)
+	}
+	if logins := server.loginCount(); logins != 2 {
+		t.Errorf("logged in %d times after the session expired, want 2", logins)
+	}
+}
+
+func TestHub4SessionExpiredConcurrent(t *testing.T) {
+	server := newHub4LoginServer(t)
+	session := newTestHub4Session(t, server.Server, "secret")
+	if _, err := session.Get(context.Background(), "/php/page.php"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests that all find the session expired log in again only once
+	server.expire()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := session.Get(context.Background(), "/php/page.php"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if logins := server.loginCount(); logins != 2 {
+		t.Errorf("logged in %d times after the session expired, want 2", logins)
+	}
+}
+
+func TestHub4SessionExpiredNoCookie(t *testing.T) {
+	server := newHub4LoginServer(t)
+	session := newTestHub4Session(t, server.Server, "secret")
+	if _, err := session.Get(context.Background(), "/php/page.php"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Logging in again without getting a new cookie is rejected, though the
+	// expired session's cookie is still kept
+	server.expire()
+	server.mutex.Lock()
+	server.noCookie = true
+	server.mutex.Unlock()
+	var loginErr *LoginError
+	if _, err := session.Get(context.Background(), "/php/page.php"); !errors.As(err, &loginErr) {
+		t.Errorf("got error %v, want a LoginError", err)
+	}
+}
+
+func TestHub4SessionPageNotFound(t *testing.T) {
+	server := newHub4LoginServer(t)
+	session := newTestHub4Session(t, server.Server, "secret")
+
+	// A redirect elsewhere than the login page means the page is missing
+	_, err := session.Get(context.Background(), "/php/moved.php")
+	if !errors.Is(err, ErrPageNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrPageNotFound)
+	}
+	if logins := server.loginCount(); logins != 1 {
+		t.Errorf("logged in %d times, want 1", logins)
+	}
+}
+
+func TestHub4SessionRejected(t *testing.T) {
+	server := newHub4LoginServer(t)
+	session := newTestHub4Session(t, server.Server, "wrong")
+
+	var loginErr *LoginError
+	err := session.Login(context.Background())
+	if !errors.As(err, &loginErr) {
+		t.Fatalf("got error %v, want a LoginError", err)
+	}
+
+	// Until the backoff has passed the modem isn't asked again, and the
+	// skipped logins aren't failures of their own
+	for i := 0; i < 3; i++ {
+		err := session.Login(context.Background())
+		if err == nil || errors.As(err, &loginErr) {
+			t.Errorf("got error %v during the backoff, want another error", err)
+		}
+	}
+	if logins := server.loginCount(); logins != 1 {
+		t.Errorf("tried to log in %d times, want 1", logins)
+	}
+}
+
+func TestHub4SessionUnreachable(t *testing.T) {
+	server := newHub4LoginServer(t)
+	session := newTestHub4Session(t, server.Server, "secret")
+	server.Close()
+
+	// Failing to reach the modem isn't a rejected login
+	var loginErr *LoginError
+	err := session.Login(context.Background())
+	if err == nil || errors.As(err, &loginErr) {
+		t.Fatalf("got error %v, want a connection error", err)
+	}
+	if reason := ErrorReason(err); reason != ReasonConnectionRefused {
+		t.Errorf("got reason %s, want %s", reason, ReasonConnectionRefused)
+	}
+}
@@ -0,0 +1,182 @@
+package drivers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hub4_exporter/config"
+	"hub4_exporter/docsis"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("hub5", &Hub5{})
+}
+
+// Hub5 reads newer Virgin Media hubs, which publish DOCSIS status through a
+// JSON REST API with named fields
+type Hub5 struct{}
+
+// hub5Status holds the downstream and upstream responses, Fetch joins them
+// into one document
+type hub5Status struct {
+	Downstream struct {
+		Downstream struct {
+			Channels []hub5Channel `json:"channels"`
+		} `json:"downstream"`
+	} `json:"downstream"`
+	Upstream struct {
+		Upstream struct {
+			Channels []hub5Channel `json:"channels"`
+		} `json:"upstream"`
+	} `json:"upstream"`
+}
+
+// hub5Channel is a channel from either direction, fields that don't apply
+// to the channel type are left out by the hub
+type hub5Channel struct {
+	ChannelID         int64   `json:"channelId"`
+	ChannelType       string  `json:"channelType"`
+	Frequency         int64   `json:"frequency"`
+	Power             float64 `json:"power"`
+	Modulation        string  `json:"modulation"`
+	LockStatus        bool    `json:"lockStatus"`
+	SNR               float64 `json:"snr"`
+	RxMER             float64 `json:"rxMer"`
+	CorrectedErrors   float64 `json:"correctedErrors"`
+	UncorrectedErrors float64 `json:"uncorrectedErrors"`
+	SymbolRate        float64 `json:"symbolRate"`
+	ChannelWidth      float64 `json:"channelWidth"`
+	FFTType           string  `json:"fftType"`
+	ActiveSubcarriers int64   `json:"numberOfActiveSubCarriers"`
+	T1Timeout         float64 `json:"t1Timeout"`
+	T2Timeout         float64 `json:"t2Timeout"`
+	T3Timeout         float64 `json:"t3Timeout"`
+	T4Timeout         float64 `json:"t4Timeout"`
+}
+
+func (d *Hub5) Fetch(ctx context.Context, httpClient *http.Client, instance *config.InstancesConfig) ([]byte, error) {
+	downstream, err := httpGet(ctx, httpClient, fmt.Sprintf("http://%s/rest/v1/cablemodem/downstream", instance.Address))
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := httpGet(ctx, httpClient, fmt.Sprintf("http://%s/rest/v1/cablemodem/upstream", instance.Address))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf(`{"downstream":%s,"upstream":%s}`, downstream, upstream)), nil
+}
+
+func (d *Hub5) Decode(instance *config.InstancesConfig, data []byte) (*docsis.Status, error) {
+	var response hub5Status
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("invalid cable modem status: %s", err)
+	}
+	// Other JSON, such as an error from the API, has neither channel list
+	if len(response.Downstream.Downstream.Channels) == 0 && len(response.Upstream.Upstream.Channels) == 0 {
+		return nil, fmt.Errorf("invalid cable modem status: no channels found")
+	}
+
+	status := &docsis.Status{}
+	for _, channel := range response.Downstream.Downstream.Channels {
+		switch strings.ToLower(channel.ChannelType) {
+		case "ofdm":
+			// The API gives the first active subcarrier's number but not the
+			// subcarrier zero frequency, so FirstSubcarrier is left unset
+			status.DS31Channels = append(status.DS31Channels, docsis.DS31Channel{
+				ID:           channel.ChannelID,
+				ChannelWidth: channel.ChannelWidth,
+				FFTType:      channel.FFTType,
+				Subcarriers:  channel.ActiveSubcarriers,
+				Modulation:   hub5Modulation(channel.Modulation),
+				Locked:       channel.LockStatus,
+				RxMER:        channel.RxMER,
+				PLCPower:     channel.Power,
+				PreRSErrors:  channel.CorrectedErrors,
+				PostRSErrors: channel.UncorrectedErrors,
+			})
+		default:
+			status.DSChannels = append(status.DSChannels, docsis.DSChannel{
+				ID:           channel.ChannelID,
+				Frequency:    channel.Frequency,
+				Power:        channel.Power,
+				SNR:          channel.SNR,
+				Modulation:   hub5Modulation(channel.Modulation),
+				Locked:       channel.LockStatus,
+				RxMER:        channel.RxMER,
+				PreRSErrors:  channel.CorrectedErrors,
+				PostRSErrors: channel.UncorrectedErrors,
+			})
+		}
+	}
+
+	for _, channel := range response.Upstream.Upstream.Channels {
+		switch strings.ToLower(channel.ChannelType) {
+		case "ofdma":
+			status.US31Channels = append(status.US31Channels, docsis.US31Channel{
+				ID:          channel.ChannelID,
+				Frequency:   channel.Frequency,
+				Power:       channel.Power,
+				FFTType:     channel.FFTType,
+				Modulation:  hub5Modulation(channel.Modulation),
+				ChannelType: "OFDMA",
+				T1Timeouts:  channel.T1Timeout,
+				T2Timeouts:  channel.T2Timeout,
+				T3Timeouts:  channel.T3Timeout,
+				T4Timeouts:  channel.T4Timeout,
+			})
+		default:
+			status.USChannels = append(status.USChannels, docsis.USChannel{
+				ID:          channel.ChannelID,
+				Frequency:   channel.Frequency,
+				Power:       channel.Power,
+				SymbolRate:  strconv.FormatFloat(channel.SymbolRate, 'f', -1, 64),
+				Modulation:  hub5Modulation(channel.Modulation),
+				ChannelType: hub5ChannelType(channel.ChannelType),
+				T1Timeouts:  channel.T1Timeout,
+				T2Timeouts:  channel.T2Timeout,
+				T3Timeouts:  channel.T3Timeout,
+				T4Timeouts:  channel.T4Timeout,
+			})
+		}
+	}
+
+	status.Counts = docsis.ChannelCounts{
+		DS:   float64(len(status.DSChannels)),
+		US:   float64(len(status.USChannels)),
+		DS31: float64(len(status.DS31Channels)),
+		US31: float64(len(status.US31Channels)),
+	}
+	return status, nil
+}
+
+// hub5Modulation converts the API's modulation names, such as qam_256, to the
+// Hub 4's, such as 256QAM
+func hub5Modulation(modulation string) string {
+	if strings.HasPrefix(modulation, "qam_") {
+		return strings.TrimPrefix(modulation, "qam_") + "QAM"
+	}
+	return modulation
+}
+
+// Upstream channel types the API names differently from the other drivers,
+// its SC-QAM channels are the Hub 4's ATDMA channels
+var hub5ChannelTypes = map[string]string{
+	"sc_qam":         "ATDMA",
+	"atdma":          "ATDMA",
+	"tdma":           "TDMA",
+	"scdma":          "SCDMA",
+	"tdma_and_atdma": "TDMA and ATDMA",
+}
+
+// hub5ChannelType converts the API's upstream channel types, such as sc_qam,
+// to the names the other drivers report, such as ATDMA. Other types are
+// upper-cased.
+func hub5ChannelType(channelType string) string {
+	if name, ok := hub5ChannelTypes[strings.ToLower(channelType)]; ok {
+		return name
+	}
+	return strings.ToUpper(channelType)
+}
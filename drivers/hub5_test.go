@@ -0,0 +1,98 @@
+package drivers
+
+import (
+	"hub4_exporter/config"
+	"testing"
+)
+
+func TestHub5(t *testing.T) {
+	server := newFixtureServer(t, map[string]string{
+		"/rest/v1/cablemodem/downstream": "hub5_downstream.json",
+		"/rest/v1/cablemodem/upstream":   "hub5_upstream.json",
+	})
+	instance := testInstance(server)
+
+	data, err := fetch(t, &Hub5{}, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := (&Hub5{}).Decode(instance, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status.DSChannels) != 2 {
+		t.Fatalf("got %d DS channels, want 2", len(status.DSChannels))
+	}
+	ds := status.DSChannels[0]
+	if ds.ID != 1 || ds.Frequency != 331000000 || ds.Power != 3.1 || ds.Modulation != "256QAM" || ds.RxMER != 40.3 || ds.PreRSErrors != 10 {
+		t.Errorf("got DS channel %+v", ds)
+	}
+
+	if len(status.DS31Channels) != 1 {
+		t.Fatalf("got %d DS 3.1 channels, want 1", len(status.DS31Channels))
+	}
+	ds31 := status.DS31Channels[0]
+	if ds31.ID != 33 || ds31.Subcarriers != 1880 || ds31.Modulation != "4096QAM" || ds31.PLCPower != -1.2 || ds31.RxMER != 41 {
+		t.Errorf("got DS 3.1 channel %+v", ds31)
+	}
+	// firstActiveSubcarrier is a subcarrier number, not a frequency
+	if ds31.FirstSubcarrier != 0 {
+		t.Errorf("got first subcarrier %d Hz, want it unset", ds31.FirstSubcarrier)
+	}
+	if start, end := ds31.FrequencyRange(); start != 0 || end != 0 {
+		t.Errorf("got frequency range %d-%d, want it unset", start, end)
+	}
+
+	if len(status.USChannels) != 1 {
+		t.Fatalf("got %d US channels, want 1", len(status.USChannels))
+	}
+	us := status.USChannels[0]
+	if us.Frequency != 49600000 || us.SymbolRate != "5120" || us.ChannelType != "ATDMA" || us.Modulation != "64QAM" || us.T3Timeouts != 2 {
+		t.Errorf("got US channel %+v", us)
+	}
+
+	if len(status.US31Channels) != 1 {
+		t.Fatalf("got %d US 3.1 channels, want 1", len(status.US31Channels))
+	}
+	us31 := status.US31Channels[0]
+	if us31.Frequency != 29800000 || us31.Power != 42 || us31.ChannelType != "OFDMA" || us31.FFTType != "2K" || us31.T3Timeouts != 1 {
+		t.Errorf("got US 3.1 channel %+v", us31)
+	}
+	if status.Counts.DS != 2 || status.Counts.US != 1 || status.Counts.DS31 != 1 || status.Counts.US31 != 1 {
+		t.Errorf("got counts %+v", status.Counts)
+	}
+}
+
+func TestHub5FetchMissingUpstream(t *testing.T) {
+	server := newFixtureServer(t, map[string]string{"/rest/v1/cablemodem/downstream": "hub5_downstream.json"})
+	if _, err := fetch(t, &Hub5{}, testInstance(server)); ErrorReason(err) != ReasonHTTPStatus {
+		t.Errorf("got %v, want a %s error", err, ReasonHTTPStatus)
+	}
+}
+
+func TestHub5DecodeInvalid(t *testing.T) {
+	for _, data := range []string{
+		`{"downstream":not json,"upstream":{}}`,
+		`{"downstream":{"error":"unauthorized"},"upstream":{}}`,
+		`{"downstream":{"downstream":{"channels":[]}},"upstream":{"upstream":{"channels":[]}}}`,
+	} {
+		if _, err := (&Hub5{}).Decode(&config.InstancesConfig{Name: "test"}, []byte(data)); err == nil {
+			t.Errorf("decoding %q: got no error", data)
+		}
+	}
+}
+
+func TestHub5ChannelType(t *testing.T) {
+	for channelType, want := range map[string]string{
+		"sc_qam": "ATDMA",
+		"SC_QAM": "ATDMA",
+		"atdma":  "ATDMA",
+		"scdma":  "SCDMA",
+		"foo":    "FOO",
+	} {
+		if got := hub5ChannelType(channelType); got != want {
+			t.Errorf("got channel type %q for %q, want %q", got, channelType, want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package drivers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"hub4_exporter/config"
+	"hub4_exporter/docsis"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register("snmp", &SNMP{})
+}
+
+// SNMP reads any cable modem that answers SNMP with the standard
+// DOCS-IF-MIB, DOCS-IF3-MIB and DOCS-IF31-MIB tables
+type SNMP struct{}
+
+var snmpAuthProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"MD5":    gosnmp.MD5,
+	"SHA":    gosnmp.SHA,
+	"SHA224": gosnmp.SHA224,
+	"SHA256": gosnmp.SHA256,
+	"SHA384": gosnmp.SHA384,
+	"SHA512": gosnmp.SHA512,
+}
+
+var snmpPrivProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"DES":     gosnmp.DES,
+	"AES":     gosnmp.AES,
+	"AES192":  gosnmp.AES192,
+	"AES256":  gosnmp.AES256,
+	"AES192C": gosnmp.AES192C,
+	"AES256C": gosnmp.AES256C,
+}
+
+var snmpSecurityLevels = map[string]gosnmp.SnmpV3MsgFlags{
+	"noauthnopriv": gosnmp.NoAuthNoPriv,
+	"authnopriv":   gosnmp.AuthNoPriv,
+	"authpriv":     gosnmp.AuthPriv,
+}
+
+// snmpClient builds a client for an instance from its snmp settings
+func snmpClient(ctx context.Context, instance *config.InstancesConfig) (*gosnmp.GoSNMP, error) {
+	conf := instance.SNMP
+	if conf == nil {
+		conf = &config.SNMPConfig{}
+	}
+
+	host, port := instance.Address, uint16(161)
+	if h, p, err := net.SplitHostPort(instance.Address); err == nil {
+		n, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in address %s", instance.Address)
+		}
+		host, port = h, uint16(n)
+	}
+
+	client := &gosnmp.GoSNMP{
+		Target:             host,
+		Port:               port,
+		Context:            ctx,
+		Community:          "public",
+		Version:            gosnmp.Version2c,
+		Retries:            1,
+		Timeout:            time.Second * 5,
+		ExponentialTimeout: false,
+		MaxOids:            gosnmp.MaxOids,
+	}
+	// Split what's left of the scrape between the tries
+	if deadline, ok := ctx.Deadline(); ok {
+		client.Timeout = time.Until(deadline) / time.Duration(client.Retries+1)
+	}
+	if conf.Community != "" {
+		client.Community = conf.Community
+	}
+
+	switch conf.Version {
+	case 0, 2:
+	case 1:
+		client.Version = gosnmp.Version1
+	case 3:
+		client.Version = gosnmp.Version3
+		client.SecurityModel = gosnmp.UserSecurityModel
+		level, ok := snmpSecurityLevels[strings.ToLower(conf.SecurityLevel)]
+		if !ok {
+			return nil, fmt.Errorf("unknown SNMP security level %q", conf.SecurityLevel)
+		}
+		client.MsgFlags = level
+		params := &gosnmp.UsmSecurityParameters{
+			UserName:               conf.Username,
+			AuthenticationProtocol: gosnmp.NoAuth,
+			PrivacyProtocol:        gosnmp.NoPriv,
+		}
+		if level != gosnmp.NoAuthNoPriv {
+			protocol, ok := snmpAuthProtocols[strings.ToUpper(conf.AuthProtocol)]
+			if !ok {
+				return nil, fmt.Errorf("unknown SNMP auth protocol %q", conf.AuthProtocol)
+			}
+			params.AuthenticationProtocol = protocol
+			params.AuthenticationPassphrase = conf.AuthPassword
+		}
+		if level == gosnmp.AuthPriv {
+			protocol, ok := snmpPrivProtocols[strings.ToUpper(conf.PrivProtocol)]
+			if !ok {
+				return nil, fmt.Errorf("unknown SNMP privacy protocol %q", conf.PrivProtocol)
+			}
+			params.PrivacyProtocol = protocol
+			params.PrivacyPassphrase = conf.PrivPassword
+		}
+		client.SecurityParameters = params
+	default:
+		return nil, fmt.Errorf("unknown SNMP version %d", conf.Version)
+	}
+	return client, nil
+}
+
+// Fetch walks the DOCSIS tables, returning the values as a JSON object keyed
+// by OID
+func (d *SNMP) Fetch(ctx context.Context, httpClient *http.Client, instance *config.InstancesConfig) ([]byte, error) {
+	client, err := snmpClient(ctx, instance)
+	if err != nil {
+		return nil, &FetchError{Reason: ReasonConnectionError, Err: err}
+	}
+	if err := client.Connect(); err != nil {
+		return nil, &FetchError{Reason: classifySNMPError(err), Err: err}
+	}
+	defer client.Conn.Close()
+
+	values := map[string]string{}
+	for _, table := range MIBTables {
+		walk := client.BulkWalkAll
+		if client.Version == gosnmp.Version1 {
+			walk = client.WalkAll
+		}
+		pdus, err := walk(table)
+		if err != nil {
+			return nil, &FetchError{Reason: classifySNMPError(err), Err: fmt.Errorf("walking %s: %w", table, err)}
+		}
+		for _, pdu := range pdus {
+			values[strings.TrimPrefix(pdu.Name, ".")] = snmpValue(pdu)
+		}
+	}
+	return json.Marshal(values)
+}
+
+func (d *SNMP) Decode(instance *config.InstancesConfig, data []byte) (*docsis.Status, error) {
+	values := map[string]string{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("invalid SNMP values: %s", err)
+	}
+	return decodeDocsIfMIB(values)
+}
+
+// sysDescr from SNMPv2-MIB
+const oidSysDescr = "1.3.6.1.2.1.1.1.0"
+
+// snmpSysDescr reads the modem's description, used to check an address
+// answers SNMP
+func snmpSysDescr(ctx context.Context, instance *config.InstancesConfig) (string, error) {
+	client, err := snmpClient(ctx, instance)
+	if err != nil {
+		return "", err
+	}
+	if err := client.Connect(); err != nil {
+		return "", err
+	}
+	defer client.Conn.Close()
+
+	result, err := client.Get([]string{oidSysDescr})
+	if err != nil {
+		return "", err
+	}
+	if len(result.Variables) == 0 || result.Variables[0].Type == gosnmp.NoSuchObject || result.Variables[0].Type == gosnmp.NoSuchInstance {
+		return "", fmt.Errorf("no sysDescr from %s", instance.Address)
+	}
+	return snmpValue(result.Variables[0]), nil
+}
+
+// snmpValue converts a value to the string form used by decodeDocsIfMIB
+func snmpValue(pdu gosnmp.SnmpPDU) string {
+	switch pdu.Type {
+	case gosnmp.OctetString:
+		if b, ok := pdu.Value.([]byte); ok {
+			return string(b)
+		}
+	case gosnmp.Integer, gosnmp.Counter32, gosnmp.Gauge32, gosnmp.Counter64, gosnmp.TimeTicks, gosnmp.Uinteger32:
+		return gosnmp.ToBigInt(pdu.Value).String()
+	}
+	return fmt.Sprint(pdu.Value)
+}
+
+// classifySNMPError maps an SNMP error to a reason, gosnmp doesn't wrap the
+// errors it returns so they are matched on the message
+func classifySNMPError(err error) string {
+	switch {
+	case strings.Contains(err.Error(), "timeout"):
+		return ReasonTimeout
+	case strings.Contains(err.Error(), "connection refused"):
+		return ReasonConnectionRefused
+	}
+	return classifyRequestError(err)
+}
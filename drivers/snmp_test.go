@@ -0,0 +1,244 @@
+package drivers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"hub4_exporter/config"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// snmpAgent answers v2c get, get-next and get-bulk requests from a walk
+type snmpAgent struct {
+	conn      net.PacketConn
+	community string
+	oids      []string
+	pdus      map[string]gosnmp.SnmpPDU
+}
+
+// newSNMPAgent starts an agent on a local port serving a snmpwalk -On file
+// from testdata
+func newSNMPAgent(t *testing.T, file string, community string) *snmpAgent {
+	f, err := os.Open("testdata/" + file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	agent := &snmpAgent{community: community, pdus: map[string]gosnmp.SnmpPDU{}}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		pdu, err := parseWalkLine(scanner.Text())
+		if err != nil {
+			t.Fatal(err)
+		}
+		agent.oids = append(agent.oids, pdu.Name)
+		agent.pdus[pdu.Name] = pdu
+	}
+	sort.Slice(agent.oids, func(i, j int) bool {
+		return compareOIDs(strings.TrimPrefix(agent.oids[i], "."), strings.TrimPrefix(agent.oids[j], ".")) < 0
+	})
+
+	agent.conn, err = net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { agent.conn.Close() })
+	go agent.serve()
+	return agent
+}
+
+// parseWalkLine parses a line such as ".1.3.6.1.2.1.1.1.0 = STRING: "x""
+func parseWalkLine(line string) (gosnmp.SnmpPDU, error) {
+	parts := strings.SplitN(line, " = ", 2)
+	if len(parts) != 2 {
+		return gosnmp.SnmpPDU{}, fmt.Errorf("invalid walk line %q", line)
+	}
+	value := strings.SplitN(parts[1], ": ", 2)
+	if len(value) != 2 {
+		return gosnmp.SnmpPDU{}, fmt.Errorf("invalid walk line %q", line)
+	}
+	pdu := gosnmp.SnmpPDU{Name: parts[0]}
+	switch value[0] {
+	case "STRING":
+		pdu.Type, pdu.Value = gosnmp.OctetString, strings.Trim(value[1], `"`)
+	case "INTEGER":
+		n, err := strconv.Atoi(value[1])
+		if err != nil {
+			return pdu, err
+		}
+		pdu.Type, pdu.Value = gosnmp.Integer, n
+	case "Counter32", "Gauge32":
+		n, err := strconv.ParseUint(value[1], 10, 32)
+		if err != nil {
+			return pdu, err
+		}
+		pdu.Type, pdu.Value = gosnmp.Counter32, uint32(n)
+		if value[0] == "Gauge32" {
+			pdu.Type = gosnmp.Gauge32
+		}
+	default:
+		return pdu, fmt.Errorf("unknown type in walk line %q", line)
+	}
+	return pdu, nil
+}
+
+// next returns the first OID after oid
+func (a *snmpAgent) next(oid string) (gosnmp.SnmpPDU, bool) {
+	oid = strings.TrimPrefix(oid, ".")
+	i := sort.Search(len(a.oids), func(i int) bool {
+		return compareOIDs(strings.TrimPrefix(a.oids[i], "."), oid) > 0
+	})
+	if i == len(a.oids) {
+		return gosnmp.SnmpPDU{Name: "." + oid, Type: gosnmp.EndOfMibView}, false
+	}
+	return a.pdus[a.oids[i]], true
+}
+
+func (a *snmpAgent) serve() {
+	decoder := &gosnmp.GoSNMP{Version: gosnmp.Version2c}
+	buffer := make([]byte, 65535)
+	for {
+		n, addr, err := a.conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		request, err := decoder.SnmpDecodePacket(buffer[:n])
+		if err != nil || request.Community != a.community {
+			continue
+		}
+
+		response := &gosnmp.SnmpPacket{
+			Version:   request.Version,
+			Community: request.Community,
+			PDUType:   gosnmp.GetResponse,
+			RequestID: request.RequestID,
+		}
+		for _, variable := range request.Variables {
+			switch request.PDUType {
+			case gosnmp.GetRequest:
+				pdu, ok := a.pdus[variable.Name]
+				if !ok {
+					pdu = gosnmp.SnmpPDU{Name: variable.Name, Type: gosnmp.NoSuchObject}
+				}
+				response.Variables = append(response.Variables, pdu)
+			case gosnmp.GetNextRequest:
+				pdu, _ := a.next(variable.Name)
+				response.Variables = append(response.Variables, pdu)
+			case gosnmp.GetBulkRequest:
+				oid := variable.Name
+				for i := 0; i < int(request.MaxRepetitions); i++ {
+					pdu, ok := a.next(oid)
+					response.Variables = append(response.Variables, pdu)
+					if !ok {
+						break
+					}
+					oid = pdu.Name
+				}
+			}
+		}
+		out, err := response.MarshalMsg()
+		if err != nil {
+			continue
+		}
+		a.conn.WriteTo(out, addr)
+	}
+}
+
+// instance returns an instance for the agent's address
+func (a *snmpAgent) instance(community string) *config.InstancesConfig {
+	return &config.InstancesConfig{
+		Name:    "test",
+		Address: a.conn.LocalAddr().String(),
+		Type:    "snmp",
+		SNMP:    &config.SNMPConfig{Community: community},
+	}
+}
+
+func TestSNMP(t *testing.T) {
+	agent := newSNMPAgent(t, "snmp_walk.txt", "private")
+	instance := agent.instance("private")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	data, err := (&SNMP{}).Fetch(ctx, nil, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := (&SNMP{}).Decode(instance, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status.DSChannels) != 2 {
+		t.Fatalf("got %d DS channels, want 2", len(status.DSChannels))
+	}
+	ds := status.DSChannels[0]
+	if ds.ID != 25 || ds.Frequency != 331000000 || ds.Power != 3.5 || ds.SNR != 40.3 || ds.RxMER != 40.6 || ds.Modulation != "256QAM" {
+		t.Errorf("got DS channel %+v", ds)
+	}
+	if ds.PreRSErrors != 10 || ds.PostRSErrors != 2 {
+		t.Errorf("got RS errors %v/%v, want 10/2", ds.PreRSErrors, ds.PostRSErrors)
+	}
+
+	// The OFDMA channel's row in the upstream table has an ID of 0
+	if len(status.USChannels) != 1 {
+		t.Fatalf("got %d US channels, want 1", len(status.USChannels))
+	}
+	us := status.USChannels[0]
+	if us.Frequency != 49600000 || us.Power != 44.5 || us.SymbolRate != "5120" || us.ChannelType != "ATDMA" || us.T3Timeouts != 3 {
+		t.Errorf("got US channel %+v", us)
+	}
+
+	if len(status.DS31Channels) != 1 {
+		t.Fatalf("got %d DS 3.1 channels, want 1", len(status.DS31Channels))
+	}
+	ds31 := status.DS31Channels[0]
+	if ds31.ID != 33 || ds31.FirstSubcarrier != 148000000 || ds31.ChannelWidth != 94 || ds31.FFTType != "4K" || ds31.Subcarriers != 1880 {
+		t.Errorf("got DS 3.1 channel %+v", ds31)
+	}
+	if ds31.PLCPower != -1.2 || ds31.PreRSErrors != 120 || ds31.PostRSErrors != 3 {
+		t.Errorf("got DS 3.1 power %v and RS errors %v/%v, want -1.2 and 120/3", ds31.PLCPower, ds31.PreRSErrors, ds31.PostRSErrors)
+	}
+
+	if len(status.US31Channels) != 1 {
+		t.Fatalf("got %d US 3.1 channels, want 1", len(status.US31Channels))
+	}
+	us31 := status.US31Channels[0]
+	// Subcarrier zero at 5MHz plus 74 subcarriers of 50kHz
+	if us31.ID != 6 || us31.Frequency != 8700000 || us31.Power != 42 || us31.FFTType != "2K" || us31.T3Timeouts != 1 {
+		t.Errorf("got US 3.1 channel %+v", us31)
+	}
+}
+
+func TestSNMPWrongCommunity(t *testing.T) {
+	agent := newSNMPAgent(t, "snmp_walk.txt", "private")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err := (&SNMP{}).Fetch(ctx, nil, agent.instance("public"))
+	if reason := ErrorReason(err); reason != ReasonTimeout {
+		t.Errorf("got reason %q, want %q", reason, ReasonTimeout)
+	}
+}
+
+func TestSNMPSysDescr(t *testing.T) {
+	agent := newSNMPAgent(t, "snmp_walk.txt", "private")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	descr, err := snmpSysDescr(ctx, agent.instance("private"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(descr, "DOCSIS 3.1 Cable Modem") {
+		t.Errorf("got sysDescr %q", descr)
+	}
+}
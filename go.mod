@@ -3,9 +3,12 @@ module hub4_exporter
 go 1.14
 
 require (
+	github.com/gosnmp/gosnmp v1.29.0
 	github.com/prometheus/client_golang v1.7.1
+	github.com/prometheus/client_model v0.2.0
 	github.com/prometheus/common v0.10.0
 	github.com/tidwall/gjson v1.6.8
+	golang.org/x/net v0.0.0-20200625001655-4c5254603344
+	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 	gopkg.in/yaml.v2 v2.3.0
-
 )
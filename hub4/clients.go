@@ -0,0 +1,47 @@
+package hub4
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tidwall/gjson"
+)
+
+// Client is a connected device from ajaxGet_device_connected_clients_data.php,
+// which the Hub 4 sends as an array of positional rows
+type Client struct {
+	Hostname  string // 0
+	MAC       string // 1
+	IP        string // 2
+	Interface string // 3 - Ethernet or Wi-Fi
+	Band      string // 4 - 2.4GHz or 5GHz, empty for Ethernet
+}
+
+// DecodeClients parses a ajaxGet_device_connected_clients_data.php response
+func DecodeClients(data []byte) ([]Client, error) {
+	if !gjson.ValidBytes(data) {
+		return nil, errors.New("invalid connected clients: not valid JSON")
+	}
+	root := gjson.ParseBytes(data)
+
+	d := &decoder{}
+	var clients []Client
+	for i, row := range d.rows(root, "clients") {
+		name := fmt.Sprintf("%d", i)
+		client := Client{
+			Hostname:  d.string(row.Get("0"), name+".0"),
+			MAC:       d.string(row.Get("1"), name+".1"),
+			IP:        d.string(row.Get("2"), name+".2"),
+			Interface: d.string(row.Get("3"), name+".3"),
+		}
+		// Only sent for Wi-Fi clients
+		if band := row.Get("4"); band.Exists() {
+			client.Band = d.string(band, name+".4")
+		}
+		clients = append(clients, client)
+	}
+
+	if len(d.errs) > 0 {
+		return nil, &DecodeError{Response: "connected clients", Fields: d.errs}
+	}
+	return clients, nil
+}
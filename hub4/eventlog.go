@@ -0,0 +1,50 @@
+package hub4
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"regexp"
+	"strings"
+)
+
+// Event is an entry of the event log from ajaxGet_device_eventlog_data.php,
+// which the Hub 4 sends as an array of positional rows
+type Event struct {
+	Time     string // 0 - as shown by the hub
+	Priority string // 1
+	Code     string // 2 - DOCSIS event ID
+	Message  string // 3
+}
+
+// Priorities are sent with their syslog level, such as "critical(3)"
+var priorityLevel = regexp.MustCompile(`^\s*([A-Za-z]+)\s*\(\d+\)\s*$`)
+
+// DecodeEventLog parses a ajaxGet_device_eventlog_data.php response
+func DecodeEventLog(data []byte) ([]Event, error) {
+	if !gjson.ValidBytes(data) {
+		return nil, errors.New("invalid event log: not valid JSON")
+	}
+	root := gjson.ParseBytes(data)
+
+	d := &decoder{}
+	var events []Event
+	for i, row := range d.rows(root, "log") {
+		name := fmt.Sprintf("%d", i)
+		priority := d.string(row.Get("1"), name+".1")
+		if match := priorityLevel.FindStringSubmatch(priority); match != nil {
+			priority = match[1]
+		}
+		events = append(events, Event{
+			Time:     d.string(row.Get("0"), name+".0"),
+			Priority: strings.ToLower(strings.TrimSpace(priority)),
+			Code:     d.string(row.Get("2"), name+".2"),
+			Message:  d.string(row.Get("3"), name+".3"),
+		})
+	}
+
+	if len(d.errs) > 0 {
+		return nil, &DecodeError{Response: "event log", Fields: d.errs}
+	}
+	return events, nil
+}
@@ -0,0 +1,348 @@
+package hub4
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"strconv"
+	"strings"
+)
+
+// NetworkStatus is the response from ajaxGet_device_networkstatus_data.php,
+// which the Hub 4 sends as a positional JSON array
+type NetworkStatus struct {
+	AcquiredDSChannel       int64         // 0 - Hz
+	RangedUSChannel         int64         // 1 - Hz
+	AcquiredDSChannelStatus string        // 2
+	RangedUSChannelStatus   string        // 3
+	ProvisioningState       float64       // 4
+	NetworkAccess           bool          // 5
+	MaxCPE                  float64       // 6
+	BPIState                bool          // 7
+	DOCSISVersion           float64       // 8
+	BootFile                string        // 9
+	DSFlowID                float64       // 10
+	DSMaxTrafficRate        float64       // 11
+	DSMaxTrafficBurst       float64       // 12
+	DSMinTrafficRate        float64       // 13
+	USFlowID                float64       // 14
+	USMaxTrafficRate        float64       // 15
+	USMaxTrafficBurst       float64       // 16
+	USMinTrafficRate        float64       // 17
+	USMaxConcatenatedBurst  float64       // 18
+	SchedulingType          string        // 19
+	DSChannels              []DSChannel   // 20
+	USChannels              []USChannel   // 21
+	DS31Channels            []DS31Channel // 23
+	US31Channels            []US31Channel // 24
+	USChannelCount          float64       // 25
+	DSChannelCount          float64       // 26
+	US31ChannelCount        float64       // 27
+	DS31ChannelCount        float64       // 28
+	PrimaryChannelType      string        // 29
+}
+
+// DSChannel is a DOCSIS 3.0 (SC-QAM) downstream channel
+type DSChannel struct {
+	ID           int64
+	Frequency    int64   // Hz
+	Power        float64 // dBmV
+	SNR          float64 // dB
+	Modulation   string
+	LockStatus   string
+	RxMER        float64 // dB
+	PreRSErrors  float64
+	PostRSErrors float64
+}
+
+// USChannel is a DOCSIS 3.0 (SC-QAM) upstream channel
+type USChannel struct {
+	ID          int64
+	Frequency   int64   // Hz
+	Power       float64 // dBmV
+	SymbolRate  string
+	Modulation  string
+	ChannelType string
+	T1Timeouts  float64
+	T2Timeouts  float64
+	T3Timeouts  float64
+	T4Timeouts  float64
+}
+
+// DS31Channel is a DOCSIS 3.1 (OFDM) downstream channel
+type DS31Channel struct {
+	ID              int64
+	ChannelWidth    float64 // MHz
+	FFTType         string
+	Subcarriers     int64
+	Modulation      string
+	FirstSubcarrier int64 // Hz
+	LockStatus      string
+	RxMER           float64 // dB
+	PLCPower        float64 // dBmV
+	PreRSErrors     float64
+	PostRSErrors    float64
+}
+
+// US31Channel is a DOCSIS 3.1 (OFDMA) upstream channel, the Hub 4 uses
+// the same layout as for USChannel
+type US31Channel struct {
+	ID          int64
+	Frequency   int64   // Hz
+	Power       float64 // dBmV
+	SymbolRate  string
+	Modulation  string
+	ChannelType string
+	T1Timeouts  float64
+	T2Timeouts  float64
+	T3Timeouts  float64
+	T4Timeouts  float64
+}
+
+// DecodeError lists every missing or mistyped field in a response
+type DecodeError struct {
+	// The response, such as network status
+	Response string
+	Fields   []string
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Response, strings.Join(e.Fields, "; "))
+}
+
+// Decode parses a ajaxGet_device_networkstatus_data.php response
+func Decode(data []byte) (*NetworkStatus, error) {
+	if !gjson.ValidBytes(data) {
+		return nil, errors.New("invalid network status: not valid JSON")
+	}
+	root := gjson.ParseBytes(data)
+	if !root.IsArray() {
+		return nil, errors.New("invalid network status: not a JSON array")
+	}
+
+	d := &decoder{}
+	fields := root.Array()
+	field := func(index int) gjson.Result {
+		if index >= len(fields) {
+			return gjson.Result{}
+		}
+		return fields[index]
+	}
+
+	status := &NetworkStatus{
+		AcquiredDSChannel:       d.int(field(0), "0"),
+		RangedUSChannel:         d.int(field(1), "1"),
+		AcquiredDSChannelStatus: d.string(field(2), "2"),
+		RangedUSChannelStatus:   d.string(field(3), "3"),
+		ProvisioningState:       d.float(field(4), "4"),
+		NetworkAccess:           d.bool(field(5), "5"),
+		MaxCPE:                  d.float(field(6), "6"),
+		BPIState:                d.bool(field(7), "7"),
+		DOCSISVersion:           d.float(field(8), "8"),
+		BootFile:                d.string(field(9), "9"),
+		DSFlowID:                d.float(field(10), "10"),
+		DSMaxTrafficRate:        d.float(field(11), "11"),
+		DSMaxTrafficBurst:       d.float(field(12), "12"),
+		DSMinTrafficRate:        d.float(field(13), "13"),
+		USFlowID:                d.float(field(14), "14"),
+		USMaxTrafficRate:        d.float(field(15), "15"),
+		USMaxTrafficBurst:       d.float(field(16), "16"),
+		USMinTrafficRate:        d.float(field(17), "17"),
+		USMaxConcatenatedBurst:  d.float(field(18), "18"),
+		SchedulingType:          d.string(field(19), "19"),
+		USChannelCount:          d.float(field(25), "25"),
+		DSChannelCount:          d.float(field(26), "26"),
+		US31ChannelCount:        d.float(field(27), "27"),
+		DS31ChannelCount:        d.float(field(28), "28"),
+		PrimaryChannelType:      d.string(field(29), "29"),
+	}
+
+	// 20 - DS Channels
+	for i, channel := range d.rows(field(20), "20") {
+		name := fmt.Sprintf("20.%d", i)
+		status.DSChannels = append(status.DSChannels, DSChannel{
+			ID:           d.int(channel.Get("0"), name+".0"),
+			Frequency:    d.int(channel.Get("1"), name+".1"),
+			Power:        d.float(channel.Get("2"), name+".2"),
+			SNR:          d.float(channel.Get("3"), name+".3"),
+			Modulation:   d.string(channel.Get("4"), name+".4"),
+			LockStatus:   d.string(channel.Get("5"), name+".5"),
+			RxMER:        d.float(channel.Get("6"), name+".6"),
+			PreRSErrors:  d.float(channel.Get("7"), name+".7"),
+			PostRSErrors: d.float(channel.Get("8"), name+".8"),
+		})
+	}
+
+	// 21 - US Channels
+	for i, channel := range d.rows(field(21), "21") {
+		name := fmt.Sprintf("21.%d", i)
+		status.USChannels = append(status.USChannels, USChannel{
+			ID:          d.int(channel.Get("0"), name+".0"),
+			Frequency:   d.int(channel.Get("1"), name+".1"),
+			Power:       d.float(channel.Get("2"), name+".2"),
+			SymbolRate:  d.string(channel.Get("3"), name+".3"),
+			Modulation:  d.string(channel.Get("4"), name+".4"),
+			ChannelType: d.string(channel.Get("5"), name+".5"),
+			T1Timeouts:  d.float(channel.Get("6"), name+".6"),
+			T2Timeouts:  d.float(channel.Get("7"), name+".7"),
+			T3Timeouts:  d.float(channel.Get("8"), name+".8"),
+			T4Timeouts:  d.float(channel.Get("9"), name+".9"),
+		})
+	}
+
+	// 22 - Network Data, not decoded
+
+	// 23 - 3.1 DS Channels
+	for i, channel := range d.rows(field(23), "23") {
+		name := fmt.Sprintf("23.%d", i)
+		status.DS31Channels = append(status.DS31Channels, DS31Channel{
+			ID:              d.int(channel.Get("0"), name+".0"),
+			ChannelWidth:    d.float(channel.Get("1"), name+".1"),
+			FFTType:         d.string(channel.Get("2"), name+".2"),
+			Subcarriers:     d.int(channel.Get("3"), name+".3"),
+			Modulation:      d.string(channel.Get("4"), name+".4"),
+			FirstSubcarrier: d.int(channel.Get("5"), name+".5"),
+			LockStatus:      d.string(channel.Get("6"), name+".6"),
+			RxMER:           d.float(channel.Get("7"), name+".7"),
+			PLCPower:        d.float(channel.Get("8"), name+".8"),
+			PreRSErrors:     d.float(channel.Get("9"), name+".9"),
+			PostRSErrors:    d.float(channel.Get("10"), name+".10"),
+		})
+	}
+
+	// 24 - 3.1 US Channels
+	for i, channel := range d.rows(field(24), "24") {
+		name := fmt.Sprintf("24.%d", i)
+		status.US31Channels = append(status.US31Channels, US31Channel{
+			ID:          d.int(channel.Get("0"), name+".0"),
+			Frequency:   d.int(channel.Get("1"), name+".1"),
+			Power:       d.float(channel.Get("2"), name+".2"),
+			SymbolRate:  d.string(channel.Get("3"), name+".3"),
+			Modulation:  d.string(channel.Get("4"), name+".4"),
+			ChannelType: d.string(channel.Get("5"), name+".5"),
+			T1Timeouts:  d.float(channel.Get("6"), name+".6"),
+			T2Timeouts:  d.float(channel.Get("7"), name+".7"),
+			T3Timeouts:  d.float(channel.Get("8"), name+".8"),
+			T4Timeouts:  d.float(channel.Get("9"), name+".9"),
+		})
+	}
+
+	if len(d.errs) > 0 {
+		return nil, &DecodeError{Response: "network status", Fields: d.errs}
+	}
+	return status, nil
+}
+
+// decoder converts fields to Go types, collecting an error for each field
+// that is missing or of the wrong type
+type decoder struct {
+	errs []string
+}
+
+func (d *decoder) fail(format string, args ...interface{}) {
+	d.errs = append(d.errs, fmt.Sprintf(format, args...))
+}
+
+func (d *decoder) exists(r gjson.Result, name string) bool {
+	if !r.Exists() {
+		d.fail("%s: missing", name)
+		return false
+	}
+	return true
+}
+
+// float accepts a JSON number or a numeric string, the Hub 4 sends most
+// numbers as strings. An empty string is taken as 0.
+func (d *decoder) float(r gjson.Result, name string) float64 {
+	if !d.exists(r, name) {
+		return 0
+	}
+	switch r.Type {
+	case gjson.Number:
+		return r.Num
+	case gjson.String:
+		s := strings.TrimSpace(r.Str)
+		if s == "" {
+			return 0
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			d.fail("%s: expected number, got %q", name, r.Str)
+			return 0
+		}
+		return v
+	}
+	d.fail("%s: expected number, got %s", name, r.Raw)
+	return 0
+}
+
+func (d *decoder) int(r gjson.Result, name string) int64 {
+	return int64(d.float(r, name))
+}
+
+func (d *decoder) string(r gjson.Result, name string) string {
+	if !d.exists(r, name) {
+		return ""
+	}
+	switch r.Type {
+	case gjson.String, gjson.Number:
+		return r.String()
+	}
+	d.fail("%s: expected string, got %s", name, r.Raw)
+	return ""
+}
+
+// bool accepts a JSON boolean or "true"/"false"
+func (d *decoder) bool(r gjson.Result, name string) bool {
+	if !d.exists(r, name) {
+		return false
+	}
+	switch r.Type {
+	case gjson.True, gjson.False:
+		return r.Bool()
+	case gjson.String:
+		switch strings.ToLower(strings.TrimSpace(r.Str)) {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
+	}
+	d.fail("%s: expected boolean, got %s", name, r.Raw)
+	return false
+}
+
+// rows returns the rows of a channel table, which may be sent either as a
+// nested array or as a string holding JSON
+func (d *decoder) rows(r gjson.Result, name string) []gjson.Result {
+	if !d.exists(r, name) {
+		return nil
+	}
+	if r.Type == gjson.String {
+		if strings.TrimSpace(r.Str) == "" {
+			return nil
+		}
+		if !gjson.Valid(r.Str) {
+			d.fail("%s: expected channel table, got %q", name, r.Str)
+			return nil
+		}
+		r = gjson.Parse(r.Str)
+	}
+	if !r.IsArray() {
+		d.fail("%s: expected channel table, got %s", name, r.Raw)
+		return nil
+	}
+
+	var rows []gjson.Result
+	for i, row := range r.Array() {
+		if row.Type == gjson.String && gjson.Valid(row.Str) {
+			row = gjson.Parse(row.Str)
+		}
+		if !row.IsArray() {
+			d.fail("%s.%d: expected channel, got %s", name, i, row.Raw)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,122 @@
+package hub4
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// recordedResponse returns the recorded response the drivers' tests use,
+// changed by edit
+func recordedResponse(t *testing.T, edit func(fields []interface{}) []interface{}) []byte {
+	data, err := ioutil.ReadFile("../drivers/testdata/hub4_networkstatus.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields []interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	data, err = json.Marshal(edit(fields))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecode(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		edit func(fields []interface{}) []interface{}
+		// Fields expected in the DecodeError, none if it should decode
+		errs  []string
+		check func(t *testing.T, status *NetworkStatus)
+	}{
+		{
+			name: "valid",
+			edit: func(fields []interface{}) []interface{} { return fields },
+			check: func(t *testing.T, status *NetworkStatus) {
+				if status.AcquiredDSChannel != 330000000 || status.AcquiredDSChannelStatus != "Locked" || !status.NetworkAccess || status.DOCSISVersion != 3.1 {
+					t.Errorf("got status %+v", status)
+				}
+				if len(status.DSChannels) != 8 || len(status.USChannels) != 6 || len(status.DS31Channels) != 1 || len(status.US31Channels) != 1 {
+					t.Errorf("got %d DS, %d US, %d DS 3.1 and %d US 3.1 channels", len(status.DSChannels), len(status.USChannels), len(status.DS31Channels), len(status.US31Channels))
+				}
+				if ds := status.DSChannels[0]; ds.ID != 1 || ds.Frequency != 330000000 || ds.SNR != 38.6 || ds.RxMER != 40.366 || ds.PreRSErrors != 12 {
+					t.Errorf("got DS channel %+v", ds)
+				}
+				if status.PrimaryChannelType != "SC-QAM" {
+					t.Errorf("got primary channel type %q, want SC-QAM", status.PrimaryChannelType)
+				}
+			},
+		},
+		{
+			name: "short array",
+			edit: func(fields []interface{}) []interface{} { return fields[:25] },
+			errs: []string{"25: missing", "26: missing", "27: missing", "28: missing", "29: missing"},
+		},
+		{
+			name: "wrong type",
+			edit: func(fields []interface{}) []interface{} {
+				fields[5] = "maybe"
+				fields[11] = map[string]interface{}{}
+				return fields
+			},
+			errs: []string{`5: expected boolean, got "maybe"`, "11: expected number, got {}"},
+		},
+		{
+			name: "wrong type in channel",
+			edit: func(fields []interface{}) []interface{} {
+				fields[23].([]interface{})[0].([]interface{})[7] = "high"
+				return fields
+			},
+			errs: []string{`23.0.7: expected number, got "high"`},
+		},
+		{
+			// The RxMER of DS 3.1 channels is at 7, after the lock status,
+			// and the PLC power at 8
+			name: "DS 3.1 RxMER",
+			edit: func(fields []interface{}) []interface{} { return fields },
+			check: func(t *testing.T, status *NetworkStatus) {
+				channel := status.DS31Channels[0]
+				if channel.LockStatus != "Locked" || channel.RxMER != 41.5 || channel.PLCPower != -1.2 {
+					t.Errorf("got lock status %q, RxMER %v and PLC power %v, want Locked, 41.5 and -1.2", channel.LockStatus, channel.RxMER, channel.PLCPower)
+				}
+				if channel.FirstSubcarrier != 148000000 || channel.FFTType != "4K" || channel.Subcarriers != 1880 {
+					t.Errorf("got DS 3.1 channel %+v", channel)
+				}
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			status, err := Decode(recordedResponse(t, test.edit))
+			if len(test.errs) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if test.check != nil {
+					test.check(t, status)
+				}
+				return
+			}
+
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("got error %v, want a DecodeError", err)
+			}
+			if got, want := strings.Join(decodeErr.Fields, "\n"), strings.Join(test.errs, "\n"); got != want {
+				t.Errorf("got fields\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, data := range []string{``, `{"0":"330000000"}`, `[`} {
+		if _, err := Decode([]byte(data)); err == nil {
+			t.Errorf("decoding %q: got no error", data)
+		}
+	}
+}
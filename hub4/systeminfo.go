@@ -0,0 +1,71 @@
+package hub4
+
+import (
+	"errors"
+	"github.com/tidwall/gjson"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SystemInfo is the response from ajaxGet_device_systeminfo_data.php, which
+// the Hub 4 sends as a positional JSON array
+type SystemInfo struct {
+	HardwareVersion string  // 0
+	SoftwareVersion string  // 1
+	SerialNumber    string  // 2
+	Uptime          float64 // 3 - seconds
+	ModelName       string  // 4 - such as F3896LG, only sent by newer firmware
+}
+
+// Uptime is sent as seconds or as shown on the page, such as
+// "12 days 03h:44m:10s"
+var uptimeText = regexp.MustCompile(`^\s*(?:(\d+)\s*days?\s*)?(\d+)h?:(\d+)m?:(\d+)s?\s*$`)
+
+// DecodeSystemInfo parses a ajaxGet_device_systeminfo_data.php response
+func DecodeSystemInfo(data []byte) (*SystemInfo, error) {
+	if !gjson.ValidBytes(data) {
+		return nil, errors.New("invalid system info: not valid JSON")
+	}
+	root := gjson.ParseBytes(data)
+	if !root.IsArray() {
+		return nil, errors.New("invalid system info: not a JSON array")
+	}
+
+	d := &decoder{}
+	info := &SystemInfo{
+		HardwareVersion: d.string(root.Get("0"), "0"),
+		SoftwareVersion: d.string(root.Get("1"), "1"),
+		SerialNumber:    d.string(root.Get("2"), "2"),
+		Uptime:          d.uptime(root.Get("3"), "3"),
+	}
+	if model := root.Get("4"); model.Exists() {
+		info.ModelName = d.string(model, "4")
+	}
+
+	if len(d.errs) > 0 {
+		return nil, &DecodeError{Response: "system info", Fields: d.errs}
+	}
+	return info, nil
+}
+
+func (d *decoder) uptime(r gjson.Result, name string) float64 {
+	if r.Type == gjson.String {
+		if match := uptimeText.FindStringSubmatch(r.Str); match != nil {
+			seconds := float64(0)
+			for i, unit := range []float64{86400, 3600, 60, 1} {
+				if match[i+1] == "" {
+					continue
+				}
+				v, _ := strconv.ParseFloat(match[i+1], 64)
+				seconds += v * unit
+			}
+			return seconds
+		}
+		if _, err := strconv.ParseFloat(strings.TrimSpace(r.Str), 64); err != nil {
+			d.fail("%s: expected uptime, got %q", name, r.Str)
+			return 0
+		}
+	}
+	return d.float(r, name)
+}
@@ -0,0 +1,95 @@
+package hub4
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"strings"
+)
+
+// Radio is a Wi-Fi radio from ajaxGet_device_wifi_status_data.php, which the
+// Hub 4 sends as an array of positional rows
+type Radio struct {
+	Band      string  // 0 - 2.4GHz or 5GHz
+	Enabled   bool    // 1
+	Channel   string  // 2
+	Bandwidth string  // 3 - such as 20MHz or 80MHz
+	Mode      string  // 4 - such as 802.11ax
+	Clients   float64 // 5
+}
+
+// Neighbour is a network found by the Wi-Fi scan from
+// ajaxGet_device_wifi_scan_data.php, which not every firmware has
+type Neighbour struct {
+	SSID    string  // 0
+	BSSID   string  // 1
+	Band    string  // 2
+	Channel string  // 3
+	Signal  float64 // 4 - dBm
+}
+
+// DecodeRadios parses a ajaxGet_device_wifi_status_data.php response
+func DecodeRadios(data []byte) ([]Radio, error) {
+	if !gjson.ValidBytes(data) {
+		return nil, errors.New("invalid Wi-Fi status: not valid JSON")
+	}
+	root := gjson.ParseBytes(data)
+
+	d := &decoder{}
+	var radios []Radio
+	for i, row := range d.rows(root, "radios") {
+		name := fmt.Sprintf("%d", i)
+		radios = append(radios, Radio{
+			Band:      d.string(row.Get("0"), name+".0"),
+			Enabled:   d.enabled(row.Get("1"), name+".1"),
+			Channel:   d.string(row.Get("2"), name+".2"),
+			Bandwidth: d.string(row.Get("3"), name+".3"),
+			Mode:      d.string(row.Get("4"), name+".4"),
+			Clients:   d.float(row.Get("5"), name+".5"),
+		})
+	}
+
+	if len(d.errs) > 0 {
+		return nil, &DecodeError{Response: "Wi-Fi status", Fields: d.errs}
+	}
+	return radios, nil
+}
+
+// DecodeNeighbours parses a ajaxGet_device_wifi_scan_data.php response
+func DecodeNeighbours(data []byte) ([]Neighbour, error) {
+	if !gjson.ValidBytes(data) {
+		return nil, errors.New("invalid Wi-Fi scan: not valid JSON")
+	}
+	root := gjson.ParseBytes(data)
+
+	d := &decoder{}
+	var neighbours []Neighbour
+	for i, row := range d.rows(root, "networks") {
+		name := fmt.Sprintf("%d", i)
+		neighbours = append(neighbours, Neighbour{
+			SSID:    d.string(row.Get("0"), name+".0"),
+			BSSID:   d.string(row.Get("1"), name+".1"),
+			Band:    d.string(row.Get("2"), name+".2"),
+			Channel: d.string(row.Get("3"), name+".3"),
+			Signal:  d.float(row.Get("4"), name+".4"),
+		})
+	}
+
+	if len(d.errs) > 0 {
+		return nil, &DecodeError{Response: "Wi-Fi scan", Fields: d.errs}
+	}
+	return neighbours, nil
+}
+
+// enabled accepts a boolean or "Enabled"/"Disabled", as shown on the page
+func (d *decoder) enabled(r gjson.Result, name string) bool {
+	if r.Type == gjson.String {
+		switch strings.ToLower(strings.TrimSpace(r.Str)) {
+		case "enabled", "on":
+			return true
+		case "disabled", "off":
+			return false
+		}
+	}
+	return d.bool(r, name)
+}
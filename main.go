@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/version"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"hub4_exporter/collectors"
+	"hub4_exporter/config"
+	"hub4_exporter/drivers"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	configFile = kingpin.Flag(
+		"config.file",
+		"Path to the configuration file.",
+	).Envar("HUB4_CONFIG_FILE").Default("config.yaml").String()
+	listenAddress = kingpin.Flag(
+		"web.listen-address",
+		"Address to listen on for web interface and telemetry, overrides the config file.",
+	).Envar("HUB4_WEB_LISTEN_ADDRESS").String()
+	telemetryPath = kingpin.Flag(
+		"web.telemetry-path",
+		"Path under which to expose metrics, overrides the config file.",
+	).Envar("HUB4_WEB_TELEMETRY_PATH").String()
+	logLevel = kingpin.Flag(
+		"log.level",
+		"Only log messages with the given severity or above. One of: [debug, info, warn, error, fatal], overrides the config file.",
+	).Envar("HUB4_LOG_LEVEL").String()
+)
+
+// Leave some of Prometheus' scrape timeout for the response to be sent
+const scrapeTimeoutOffset = time.Millisecond * 500
+
+// scrapeContext returns the request's context, limited to Prometheus' scrape
+// timeout when the request has one
+func scrapeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			log.Warnf("Invalid scrape timeout header %q: %s", v, err)
+		} else {
+			timeout := time.Duration(seconds*float64(time.Second)) - scrapeTimeoutOffset
+			if timeout <= 0 {
+				timeout = time.Duration(seconds * float64(time.Second))
+			}
+			return context.WithTimeout(r.Context(), timeout)
+		}
+	}
+	return context.WithCancel(r.Context())
+}
+
+// metricsHandler collects from the exporter for each request
+func metricsHandler(exporter *collectors.Exporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := scrapeContext(r)
+		defer cancel()
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(exporter.WithContext(ctx))
+		gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, registry}
+		promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
+
+// probeHandler collects from the target given in the request using the
+// settings of its module, without a module the modem is detected
+func probeHandler(exporter *collectors.Exporter, conf *config.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "target parameter is missing", http.StatusBadRequest)
+			return
+		}
+		module := &config.ModuleConfig{}
+		if name := r.URL.Query().Get("module"); name != "" {
+			var ok bool
+			module, ok = conf.Modules[name]
+			if !ok {
+				http.Error(w, fmt.Sprintf("unknown module %q", name), http.StatusBadRequest)
+				return
+			}
+		}
+
+		ctx, cancel := scrapeContext(r)
+		defer cancel()
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(exporter.Probe(ctx, module.Instance(target)))
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
+
+// checkTelemetryPath checks the metrics can be served on path, which must
+// start with / and not be the path of the landing page or /probe
+func checkTelemetryPath(path string) error {
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("telemetry path %q must start with /", path)
+	}
+	if path == "/" {
+		return fmt.Errorf("telemetry path %q is used by the landing page", path)
+	}
+	if path == "/probe" {
+		return fmt.Errorf("telemetry path %q is used by the probe endpoint", path)
+	}
+	return nil
+}
+
+func main() {
+	kingpin.Version(version.Print("hub4_exporter"))
+	kingpin.HelpFlag.Short('h')
+	kingpin.Parse()
+
+	// Load config
+	conf, err := config.ConfigLoadFromFile(*configFile)
+	if err != nil {
+		log.Fatalf("Unable to load config %s: %s", *configFile, err)
+	}
+
+	// Flags and environment override the config file
+	if *listenAddress != "" {
+		conf.ListenAddress = *listenAddress
+	}
+	if *telemetryPath != "" {
+		conf.TelemetryPath = *telemetryPath
+	}
+	if *logLevel != "" {
+		conf.LogLevel = *logLevel
+	}
+	if err := log.Base().SetLevel(conf.LogLevel); err != nil {
+		log.Fatalf("Invalid log level %s: %s", conf.LogLevel, err)
+	}
+	if err := checkTelemetryPath(conf.TelemetryPath); err != nil {
+		log.Fatalf("Invalid telemetry path: %s", err)
+	}
+
+	// Check every instance has a known modem type and the settings its
+	// driver needs, or is to be detected
+	for _, instance := range conf.Instances {
+		if err := drivers.Check(instance); err != nil {
+			log.Fatalf("Instance %s: %s", instance.Name, err)
+		}
+	}
+	for name, module := range conf.Modules {
+		if err := drivers.Check(module.Instance(name)); err != nil {
+			log.Fatalf("Module %s: %s", name, err)
+		}
+	}
+
+	// Create the exporter
+	exporter := collectors.PromExporter(conf.Timeout, conf)
+	exporter.DetectModels(context.Background())
+	pollCtx, stopPolling := context.WithCancel(context.Background())
+	defer stopPolling()
+	exporter.StartPolling(pollCtx)
+
+	// HTTP server
+	mux := http.NewServeMux()
+	mux.Handle(conf.TelemetryPath, metricsHandler(exporter))
+	mux.Handle("/probe", probeHandler(exporter, conf))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html>
+<head><title>Hub 4 Exporter</title></head>
+<body>
+<h1>Hub 4 Exporter</h1>
+<p><a href="`+conf.TelemetryPath+`">Metrics</a></p>
+<p>Probe a modem with /probe?target=&lt;address&gt;&amp;module=&lt;module&gt;</p>
+</body>
+</html>`)
+	})
+	server := &http.Server{
+		Addr:    conf.ListenAddress,
+		Handler: mux,
+	}
+
+	go func() {
+		log.Infof("Listening on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Unable to start HTTP server: %s", err)
+		}
+	}()
+
+	// Wait for SIGINT/SIGTERM then shut down cleanly
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-stop
+	log.Infof("Received %s, shutting down", sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Errorf("Error shutting down HTTP server: %s", err)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestCheckTelemetryPath(t *testing.T) {
+	for _, test := range []struct {
+		path string
+		ok   bool
+	}{
+		{"/metrics", true},
+		{"/hub4/metrics", true},
+		{"metrics", false},
+		{"", false},
+		{"/", false},
+		{"/probe", false},
+	} {
+		if err := checkTelemetryPath(test.path); (err == nil) != test.ok {
+			t.Errorf("%q: got error %v, want ok %t", test.path, err, test.ok)
+		}
+	}
+}